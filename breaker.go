@@ -0,0 +1,308 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen زمانی برگردانده می‌شود که breaker درایور باز است و درخواست بدون
+// تماس با درگاه رد می‌شود
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState وضعیت circuit breaker یک درایور
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerConfig تنظیمات circuit breaker. نرخ خطا و نرخ فراخوانی‌های کند روی
+// آخرین WindowSize فراخوانی محاسبه می‌شود و تا MinCalls فراخوانی ثبت نشده breaker باز نمی‌شود.
+type BreakerConfig struct {
+	WindowSize            int
+	MinCalls              int
+	FailureRateThreshold  float64
+	SlowCallThreshold     time.Duration
+	SlowCallRateThreshold float64
+	OpenTimeout           time.Duration // مدت باز ماندن پیش از ورود به half-open
+	HalfOpenCalls         int           // تعداد فراخوانی‌های آزمایشی موفق لازم برای بسته شدن
+}
+
+// DefaultBreakerConfig تنظیمات پیش‌فرض breaker های Client
+var DefaultBreakerConfig = BreakerConfig{
+	WindowSize:            20,
+	MinCalls:              5,
+	FailureRateThreshold:  0.5,
+	SlowCallThreshold:     10 * time.Second,
+	SlowCallRateThreshold: 0.8,
+	OpenTimeout:           30 * time.Second,
+	HalfOpenCalls:         2,
+}
+
+// WithBreakerConfig تنظیمات circuit breaker درایورهای Client را تعیین می‌کند
+func WithBreakerConfig(config BreakerConfig) Option {
+	return func(c *Client) {
+		c.breakerConfig = config
+	}
+}
+
+type callOutcome struct {
+	failed  bool
+	slow    bool
+	latency time.Duration
+}
+
+// CircuitBreaker خطاهای در دسترس نبودن درگاه و تأخیر فراخوانی‌ها را دنبال می‌کند و
+// در صورت خرابی پایدار، درخواست‌ها را تا OpenTimeout بدون تماس با درگاه رد می‌کند.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	state    BreakerState
+	window   []callOutcome
+	next     int
+	openedAt time.Time
+	probes   int    // فراخوانی‌های آزمایشی در جریان در وضعیت half-open
+	passed   int    // فراخوانی‌های آزمایشی موفق در وضعیت half-open
+	gen      uint64 // با هر تغییر وضعیت افزایش می‌یابد تا نتیجه فراخوانی‌های قدیمی جدا شود
+	now      func() time.Time
+}
+
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.WindowSize < 1 {
+		config.WindowSize = 1
+	}
+	if config.HalfOpenCalls < 1 {
+		config.HalfOpenCalls = 1
+	}
+	return &CircuitBreaker{
+		config: config,
+		window: make([]callOutcome, 0, config.WindowSize),
+		now:    time.Now,
+	}
+}
+
+// Execute در صورت باز نبودن breaker تابع fn را اجرا و نتیجه و مدت آن را ثبت می‌کند.
+// فقط خطاهای قابل تکرار (در دسترس نبودن درگاه) و پایان مهلت ctx خطا حساب می‌شوند؛
+// خطاهای تجاری مثل موجودی ناکافی وضعیت breaker را تغییر نمی‌دهند.
+func (b *CircuitBreaker) Execute(fn func() error) error {
+	gen, err := b.allow()
+	if err != nil {
+		return err
+	}
+	start := b.now()
+	err = fn()
+	b.record(gen, isBreakerFailure(err), b.now().Sub(start))
+	return err
+}
+
+// State وضعیت فعلی breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	return b.state
+}
+
+// allow فراخوانی را می‌پذیرد یا رد می‌کند و نسلی از breaker را که فراخوانی در آن
+// پذیرفته شده برمی‌گرداند؛ در half-open هر فراخوانی پذیرفته‌شده یک probe است
+func (b *CircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	switch b.state {
+	case BreakerOpen:
+		return 0, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes+b.passed >= b.config.HalfOpenCalls {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return b.gen, nil
+}
+
+// refresh پس از گذشت OpenTimeout وضعیت open را به half-open می‌برد
+func (b *CircuitBreaker) refresh() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.probes, b.passed = 0, 0
+		b.gen++
+	}
+}
+
+// record نتیجه فراخوانی پذیرفته‌شده در نسل gen را ثبت می‌کند. فراخوانی‌ای که پیش از
+// تغییر وضعیت پذیرفته شده (مثلاً در closed و پایان‌یافته در half-open) probe نیست و
+// نتیجه‌اش کنار گذاشته می‌شود.
+func (b *CircuitBreaker) record(gen uint64, failed bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if gen != b.gen {
+		return
+	}
+
+	slow := b.config.SlowCallThreshold > 0 && latency >= b.config.SlowCallThreshold
+	outcome := callOutcome{failed: failed, slow: slow, latency: latency}
+	if len(b.window) < b.config.WindowSize {
+		b.window = append(b.window, outcome)
+	} else {
+		b.window[b.next] = outcome
+	}
+	b.next = (b.next + 1) % b.config.WindowSize
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probes--
+		if failed || slow {
+			b.trip()
+			return
+		}
+		if b.passed++; b.passed >= b.config.HalfOpenCalls {
+			b.state = BreakerClosed
+			b.window, b.next = b.window[:0], 0
+			b.gen++
+		}
+	case BreakerClosed:
+		stats := b.stats()
+		if stats.Calls < b.config.MinCalls {
+			return
+		}
+		if stats.FailureRate >= b.config.FailureRateThreshold ||
+			(b.config.SlowCallRateThreshold > 0 && stats.SlowCallRate >= b.config.SlowCallRateThreshold) {
+			b.trip()
+		}
+	}
+}
+
+func (b *CircuitBreaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.probes, b.passed = 0, 0
+	b.gen++
+}
+
+type breakerStats struct {
+	Calls        int
+	FailureRate  float64
+	SlowCallRate float64
+	AvgLatency   time.Duration
+}
+
+func (b *CircuitBreaker) stats() breakerStats {
+	stats := breakerStats{Calls: len(b.window)}
+	if stats.Calls == 0 {
+		return stats
+	}
+	var failed, slow int
+	var total time.Duration
+	for _, outcome := range b.window {
+		if outcome.failed {
+			failed++
+		}
+		if outcome.slow {
+			slow++
+		}
+		total += outcome.latency
+	}
+	stats.FailureRate = float64(failed) / float64(stats.Calls)
+	stats.SlowCallRate = float64(slow) / float64(stats.Calls)
+	stats.AvgLatency = total / time.Duration(stats.Calls)
+	return stats
+}
+
+func isBreakerFailure(err error) bool {
+	return err != nil && (IsRetryable(err) || errors.Is(err, context.DeadlineExceeded))
+}
+
+// DriverHealth وضعیت سلامت یک درایور بر اساس breaker آن
+type DriverHealth struct {
+	Driver       string        `json:"driver"`
+	State        string        `json:"state"`
+	Available    bool          `json:"available"`
+	Calls        int           `json:"calls"`
+	FailureRate  float64       `json:"failure_rate"`
+	SlowCallRate float64       `json:"slow_call_rate"`
+	AvgLatency   time.Duration `json:"avg_latency"`
+	OpenedAt     time.Time     `json:"opened_at,omitzero"`
+}
+
+// Health وضعیت سلامت همه درایورهای پیکربندی‌شده را به ترتیب نام برمی‌گرداند. درایورهایی
+// که breaker آن‌ها باز است Available=false دارند و می‌توان آن‌ها را از صفحه پرداخت پنهان کرد.
+func (c *Client) Health() []DriverHealth {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.config.Drivers))
+	for name := range c.config.Drivers {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	health := make([]DriverHealth, 0, len(names))
+	for _, name := range names {
+		health = append(health, c.breaker(name).health(name))
+	}
+	return health
+}
+
+func (b *CircuitBreaker) health(name string) DriverHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	stats := b.stats()
+	h := DriverHealth{
+		Driver:       name,
+		State:        b.state.String(),
+		Available:    b.state != BreakerOpen,
+		Calls:        stats.Calls,
+		FailureRate:  stats.FailureRate,
+		SlowCallRate: stats.SlowCallRate,
+		AvgLatency:   stats.AvgLatency,
+	}
+	if b.state != BreakerClosed {
+		h.OpenedAt = b.openedAt
+	}
+	return h
+}
+
+// breaker breaker درایور name را برمی‌گرداند و در صورت نبود آن را می‌سازد
+func (c *Client) breaker(name string) *CircuitBreaker {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+
+	b, ok := c.breakers[name]
+	if !ok {
+		b = NewCircuitBreaker(c.breakerConfig)
+		c.breakers[name] = b
+	}
+	return b
+}
+
+// guard فراخوانی درایور name را از breaker آن عبور می‌دهد
+func (c *Client) guard(name string, fn func() error) error {
+	err := c.breaker(name).Execute(fn)
+	if err == ErrCircuitOpen {
+		return fmt.Errorf("driver '%s' is unavailable: %w", name, ErrCircuitOpen)
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testBreakerConfig = BreakerConfig{
+	WindowSize:            4,
+	MinCalls:              4,
+	FailureRateThreshold:  0.5,
+	SlowCallThreshold:     time.Second,
+	SlowCallRateThreshold: 0.75,
+	OpenTimeout:           time.Minute,
+	HalfOpenCalls:         2,
+}
+
+// newTestBreaker یک breaker با ساعت قابل کنترل می‌سازد
+func newTestBreaker() (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	b := NewCircuitBreaker(testBreakerConfig)
+	b.now = clock.Now
+	return b, clock
+}
+
+var errUnavailable = &GatewayError{Kind: ErrGatewayUnavailable}
+
+func execute(b *CircuitBreaker, errs ...error) {
+	for _, err := range errs {
+		_ = b.Execute(func() error { return err })
+	}
+}
+
+func TestBreakerOpensOnFailureRate(t *testing.T) {
+	b, _ := newTestBreaker()
+
+	execute(b, errUnavailable, errUnavailable, nil)
+	if b.State() != BreakerClosed {
+		t.Fatal("breaker opened before MinCalls")
+	}
+	execute(b, nil)
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s after 50%% failures, want open", b.State())
+	}
+
+	called := false
+	err := b.Execute(func() error { called = true; return nil })
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Fatalf("open breaker: err %v, called %v", err, called)
+	}
+}
+
+func TestBreakerIgnoresBusinessErrors(t *testing.T) {
+	b, _ := newTestBreaker()
+	declined := &GatewayError{Kind: ErrInsufficientFunds}
+	execute(b, declined, declined, declined, declined, declined)
+	if b.State() != BreakerClosed {
+		t.Fatalf("state = %s after business errors, want closed", b.State())
+	}
+
+	execute(b, context.DeadlineExceeded, context.DeadlineExceeded)
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s after deadline errors, want open", b.State())
+	}
+}
+
+func TestBreakerOpensOnSlowCalls(t *testing.T) {
+	b, clock := newTestBreaker()
+	for range 3 {
+		_ = b.Execute(func() error { clock.now = clock.now.Add(2 * time.Second); return nil })
+	}
+	execute(b, nil)
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s after 75%% slow calls, want open", b.State())
+	}
+}
+
+func TestBreakerHalfOpenRecovery(t *testing.T) {
+	b, clock := newTestBreaker()
+	execute(b, errUnavailable, errUnavailable, errUnavailable, errUnavailable)
+
+	clock.now = clock.now.Add(time.Minute)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s after OpenTimeout, want half_open", b.State())
+	}
+
+	// فقط HalfOpenCalls فراخوانی آزمایشی هم‌زمان مجاز است
+	probe := make(chan struct{})
+	done := make(chan error)
+	for range 2 {
+		go func() { done <- b.Execute(func() error { <-probe; return nil }) }()
+	}
+	for inFlight := 0; inFlight < 2; time.Sleep(time.Millisecond) {
+		b.mu.Lock()
+		inFlight = b.probes
+		b.mu.Unlock()
+	}
+	if err := b.Execute(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("extra probe err = %v, want ErrCircuitOpen", err)
+	}
+	close(probe)
+	for range 2 {
+		if err := <-done; err != nil {
+			t.Fatalf("probe: %v", err)
+		}
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("state = %s after successful probes, want closed", b.State())
+	}
+	if h := b.health("zp"); h.Calls != 0 || !h.Available {
+		t.Fatalf("window not reset after closing: %+v", h)
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b, clock := newTestBreaker()
+	execute(b, errUnavailable, errUnavailable, errUnavailable, errUnavailable)
+	clock.now = clock.now.Add(time.Minute)
+
+	execute(b, errUnavailable)
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s after failed probe, want open", b.State())
+	}
+	if h := b.health("zp"); h.Available || !h.OpenedAt.Equal(clock.now) {
+		t.Fatalf("health = %+v", h)
+	}
+}
+
+func TestBreakerIgnoresCallsAdmittedBeforeHalfOpen(t *testing.T) {
+	b, clock := newTestBreaker()
+	stale, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	execute(b, errUnavailable, errUnavailable, errUnavailable, errUnavailable)
+	clock.now = clock.now.Add(time.Minute)
+	if _, err := b.allow(); err != nil {
+		t.Fatalf("first probe: %v", err)
+	}
+
+	// فراخوانی پذیرفته‌شده در closed که در half-open تمام می‌شود probe حساب نمی‌شود
+	b.record(stale, false, 0)
+	b.record(stale, true, 0)
+	if b.State() != BreakerHalfOpen || b.probes != 1 || b.passed != 0 {
+		t.Fatalf("state %s, probes %d, passed %d after a stale outcome", b.State(), b.probes, b.passed)
+	}
+	if _, err := b.allow(); err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("extra probe err = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestClientGuardReportsOpenBreaker(t *testing.T) {
+	config := testBreakerConfig
+	config.MinCalls, config.WindowSize = 1, 1
+	c := newTestClient(t, []string{"backup", "zp"}, WithBreakerConfig(config))
+	fakeOf(t, c, "zp").inquire = func(context.Context, *TransactionRef) (*InquiryResponse, error) {
+		return nil, errUnavailable
+	}
+
+	ctx := context.Background()
+	_, _ = c.Inquire(ctx, "zp", &TransactionRef{})
+	_, err := c.Inquire(ctx, "zp", &TransactionRef{})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := fakeOf(t, c, "zp").Calls(OpInquiry); n != 1 {
+		t.Fatalf("driver called %d times, want 1", n)
+	}
+
+	health := c.Health()
+	if len(health) != 2 || health[0].Driver != "backup" || !health[0].Available || health[1].Available || health[1].State != "open" {
+		t.Fatalf("Health = %+v", health)
+	}
+}
@@ -0,0 +1,107 @@
+package gopay
+
+import (
+	"errors"
+	"net/http"
+	"path"
+)
+
+// CallbackResult نتیجه پردازش یک callback که به hook ها داده می‌شود
+type CallbackResult struct {
+	Driver   string
+	Response *VerificationResponse
+	Err      error
+}
+
+type CallbackHook func(w http.ResponseWriter, r *http.Request, result *CallbackResult)
+
+type CallbackHooks struct {
+	OnSuccess        CallbackHook // StatusSuccess و StatusAlreadyVerified
+	OnFailure        CallbackHook // سایر وضعیت‌ها و خطاها
+	OnCancelled      CallbackHook // StatusCancelled یا خطای ErrUserCancelled
+	OnAmountMismatch CallbackHook
+}
+
+// CallbackHandler یک http.Handler آماده برای آدرس بازگشت از درگاه است.
+// نام درایور از الگوی مسیر {driver} (http.ServeMux)، پارامتر query با نام
+// DriverParam یا آخرین بخش مسیر (/callback/mellat) خوانده می‌شود و callback های
+// GET (زرین‌پال) و POST (بانک‌های شاپرکی) هر دو پشتیبانی می‌شوند.
+// اگر Fetcher خالی باشد، Client.VerifyAndConfirm با Store کلاینت استفاده می‌شود.
+type CallbackHandler struct {
+	Client      *Client
+	Fetcher     TransactionFetcher
+	Hooks       CallbackHooks
+	DriverParam string
+}
+
+func NewCallbackHandler(client *Client, fetcher TransactionFetcher, hooks CallbackHooks) *CallbackHandler {
+	return &CallbackHandler{
+		Client:      client,
+		Fetcher:     fetcher,
+		Hooks:       hooks,
+		DriverParam: "driver",
+	}
+}
+
+func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := h.driverName(r)
+	result := &CallbackResult{Driver: name}
+
+	verifier, err := h.Client.Verifier(name)
+	if err != nil {
+		result.Err = err
+		h.dispatch(h.Hooks.OnFailure, w, r, result, http.StatusNotFound)
+		return
+	}
+
+	if h.Fetcher == nil {
+		result.Response, result.Err = h.Client.VerifyAndConfirm(r.Context(), name, r)
+	} else {
+		result.Response, result.Err = verifier.VerifyAndConfirm(r.Context(), r, h.Fetcher)
+	}
+	if result.Response == nil {
+		if result.Err == nil {
+			result.Err = errors.New("driver returned no verification response")
+		}
+		h.dispatch(h.Hooks.OnFailure, w, r, result, http.StatusBadGateway)
+		return
+	}
+
+	switch status := result.Response.Status; {
+	case status == StatusSuccess || status == StatusAlreadyVerified:
+		h.dispatch(h.Hooks.OnSuccess, w, r, result, http.StatusOK)
+	case status == StatusCancelled || errors.Is(result.Err, ErrUserCancelled):
+		h.dispatch(h.Hooks.OnCancelled, w, r, result, http.StatusOK)
+	case status == StatusAmountMismatch:
+		h.dispatch(h.Hooks.OnAmountMismatch, w, r, result, http.StatusConflict)
+	default:
+		h.dispatch(h.Hooks.OnFailure, w, r, result, http.StatusPaymentRequired)
+	}
+}
+
+func (h *CallbackHandler) driverName(r *http.Request) string {
+	if name := r.PathValue("driver"); name != "" {
+		return name
+	}
+	if h.DriverParam != "" {
+		if name := r.URL.Query().Get(h.DriverParam); name != "" {
+			return name
+		}
+	}
+	return path.Base(path.Clean("/" + r.URL.Path))
+}
+
+// dispatch در صورت تعریف نشدن hook یک پاسخ متنی ساده با کد وضعیت پیش‌فرض می‌نویسد
+func (h *CallbackHandler) dispatch(hook CallbackHook, w http.ResponseWriter, r *http.Request, result *CallbackResult, fallback int) {
+	if hook != nil {
+		hook(w, r, result)
+		return
+	}
+	http.Error(w, http.StatusText(fallback), fallback)
+}
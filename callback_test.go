@@ -0,0 +1,132 @@
+package gopay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordHook نام hook فراخوانی‌شده و نتیجه آن را ثبت می‌کند
+func recordHook(name string, called *string, got **CallbackResult) CallbackHook {
+	return func(w http.ResponseWriter, r *http.Request, result *CallbackResult) {
+		*called, *got = name, result
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestCallbackHandlerDispatchesByStatus(t *testing.T) {
+	tests := []struct {
+		status VerificationStatus
+		want   string
+	}{
+		{StatusSuccess, "success"},
+		{StatusAlreadyVerified, "success"},
+		{StatusCancelled, "cancelled"},
+		{StatusAmountMismatch, "mismatch"},
+		{StatusFailed, "failure"},
+	}
+	for _, tt := range tests {
+		status, want := tt.status, tt.want
+		t.Run(fmt.Sprintf("status_%d", status), func(t *testing.T) {
+			c := newTestClient(t, []string{"mellat"})
+			fakeOf(t, c, "mellat").verify = func(context.Context, *http.Request, TransactionFetcher) (*VerificationResponse, error) {
+				return &VerificationResponse{Status: status}, nil
+			}
+			var called string
+			var result *CallbackResult
+			h := NewCallbackHandler(c, func(context.Context, string) (*OriginalTransaction, error) { return nil, nil }, CallbackHooks{
+				OnSuccess:        recordHook("success", &called, &result),
+				OnFailure:        recordHook("failure", &called, &result),
+				OnCancelled:      recordHook("cancelled", &called, &result),
+				OnAmountMismatch: recordHook("mismatch", &called, &result),
+			})
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/callback/mellat", strings.NewReader("RefId=1")))
+			if called != want || result.Driver != "mellat" || result.Response.Status != status {
+				t.Fatalf("hook %q with %+v, want %q", called, result, want)
+			}
+		})
+	}
+}
+
+func TestCallbackHandlerTreatsUserCancellationAsCancelled(t *testing.T) {
+	c := newTestClient(t, []string{"mellat"})
+	fakeOf(t, c, "mellat").verify = func(context.Context, *http.Request, TransactionFetcher) (*VerificationResponse, error) {
+		return &VerificationResponse{Status: StatusFailed}, &GatewayError{Kind: ErrUserCancelled}
+	}
+	var called string
+	var result *CallbackResult
+	h := NewCallbackHandler(c, func(context.Context, string) (*OriginalTransaction, error) { return nil, nil }, CallbackHooks{
+		OnFailure:   recordHook("failure", &called, &result),
+		OnCancelled: recordHook("cancelled", &called, &result),
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/callback/mellat", nil))
+	if called != "cancelled" {
+		t.Fatalf("hook %q, want cancelled", called)
+	}
+}
+
+func TestCallbackHandlerResolvesDriverName(t *testing.T) {
+	c := newTestClient(t, []string{"mellat", "zarinpal"})
+	h := NewCallbackHandler(c, func(context.Context, string) (*OriginalTransaction, error) {
+		return &OriginalTransaction{Amount: Rials(10000)}, nil
+	}, CallbackHooks{})
+
+	mux := http.NewServeMux()
+	mux.Handle("/pattern/{driver}/return", h)
+	mux.Handle("/", h)
+
+	for target, want := range map[string]string{
+		"/pattern/mellat/return":    "mellat",
+		"/callback?driver=zarinpal": "zarinpal",
+		"/callback/mellat/":         "mellat",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK || fakeOf(t, c, want).Calls(OpVerify) == 0 {
+			t.Errorf("%s: status %d, %s verified %d times", target, w.Code, want, fakeOf(t, c, want).Calls(OpVerify))
+		}
+	}
+}
+
+func TestCallbackHandlerFallbacks(t *testing.T) {
+	c := newTestClient(t, []string{"mellat"})
+	h := NewCallbackHandler(c, nil, CallbackHooks{})
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodPut, "/callback/mellat", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/callback/unknown", http.StatusNotFound},
+		// بدون Fetcher تراکنش از Store خوانده می‌شود و تراکنش ناشناخته رد می‌شود
+		{http.MethodGet, "/callback/mellat?key=missing", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+}
+
+func TestCallbackHandlerUsesClientStore(t *testing.T) {
+	c := newTestClient(t, []string{"mellat"})
+	tx := purchaseTx(t, c, "mellat")
+	h := NewCallbackHandler(c, nil, CallbackHooks{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/callback/mellat?key="+tx.Authority, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	stored, err := c.Store().FindByAuthority(context.Background(), "mellat", tx.Authority)
+	if err != nil || stored.State == tx.State {
+		t.Fatalf("transaction state not advanced: %+v, %v", stored, err)
+	}
+}
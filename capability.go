@@ -0,0 +1,208 @@
+package gopay
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedOperation زمانی برگردانده می‌شود که درایور عملیات درخواستی را پشتیبانی نکند
+var ErrUnsupportedOperation = errors.New("unsupported operation")
+
+type Capability int
+
+const (
+	CapabilityPurchase Capability = iota
+	CapabilityVerify
+	CapabilitySettle
+	CapabilityReverse
+	CapabilityRefund
+	CapabilityInquiry
+	CapabilityPartialRefund
+)
+
+var allCapabilities = []Capability{
+	CapabilityPurchase,
+	CapabilityVerify,
+	CapabilitySettle,
+	CapabilityReverse,
+	CapabilityRefund,
+	CapabilityInquiry,
+	CapabilityPartialRefund,
+}
+
+func (c Capability) String() string {
+	switch c {
+	case CapabilityPurchase:
+		return "purchase"
+	case CapabilityVerify:
+		return "verify"
+	case CapabilitySettle:
+		return "settle"
+	case CapabilityReverse:
+		return "reverse"
+	case CapabilityRefund:
+		return "refund"
+	case CapabilityInquiry:
+		return "inquiry"
+	case CapabilityPartialRefund:
+		return "partial_refund"
+	default:
+		return fmt.Sprintf("capability(%d)", int(c))
+	}
+}
+
+// Supports بررسی می‌کند که درایور قابلیت داده‌شده را دارد یا نه
+func Supports(driver Driver, capability Capability) bool {
+	switch capability {
+	case CapabilityPurchase:
+		_, ok := driver.(Purchaser)
+		return ok
+	case CapabilityVerify:
+		_, ok := driver.(Verifier)
+		return ok
+	case CapabilitySettle:
+		_, ok := driver.(Settler)
+		return ok
+	case CapabilityReverse:
+		_, ok := driver.(Reverser)
+		return ok
+	case CapabilityRefund:
+		_, ok := driver.(Refundable)
+		return ok
+	case CapabilityInquiry:
+		_, ok := driver.(Inquirer)
+		return ok
+	case CapabilityPartialRefund:
+		p, ok := driver.(PartialRefunder)
+		return ok && p.SupportsPartialRefund()
+	default:
+		return false
+	}
+}
+
+// CapabilitiesOf فهرست قابلیت‌های پشتیبانی‌شده توسط درایور را برمی‌گرداند
+func CapabilitiesOf(driver Driver) []Capability {
+	var caps []Capability
+	for _, c := range allCapabilities {
+		if Supports(driver, c) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+func unsupported(name string, capability Capability) error {
+	return fmt.Errorf("driver '%s' does not support %s: %w", name, capability, ErrUnsupportedOperation)
+}
+
+func (c *Client) Capabilities(name string) ([]Capability, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	return CapabilitiesOf(driver), nil
+}
+
+func (c *Client) Supports(name string, capability Capability) (bool, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return false, err
+	}
+	return Supports(driver, capability), nil
+}
+
+func (c *Client) RedirectPayer(name string) (RedirectPayer, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	payer, ok := driver.(RedirectPayer)
+	if !ok {
+		return nil, unsupported(name, CapabilityPurchase)
+	}
+	return payer, nil
+}
+
+func (c *Client) Purchaser(name string) (Purchaser, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := driver.(Purchaser)
+	if !ok {
+		return nil, unsupported(name, CapabilityPurchase)
+	}
+	return p, nil
+}
+
+func (c *Client) Verifier(name string) (Verifier, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := driver.(Verifier)
+	if !ok {
+		return nil, unsupported(name, CapabilityVerify)
+	}
+	return v, nil
+}
+
+func (c *Client) Settler(name string) (Settler, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := driver.(Settler)
+	if !ok {
+		return nil, unsupported(name, CapabilitySettle)
+	}
+	return s, nil
+}
+
+func (c *Client) Reverser(name string) (Reverser, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := driver.(Reverser)
+	if !ok {
+		return nil, unsupported(name, CapabilityReverse)
+	}
+	return r, nil
+}
+
+func (c *Client) Refunder(name string) (Refundable, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := driver.(Refundable)
+	if !ok {
+		return nil, unsupported(name, CapabilityRefund)
+	}
+	return r, nil
+}
+
+func (c *Client) PartialRefunder(name string) (PartialRefunder, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := driver.(PartialRefunder)
+	if !ok || !r.SupportsPartialRefund() {
+		return nil, unsupported(name, CapabilityPartialRefund)
+	}
+	return r, nil
+}
+
+func (c *Client) Inquirer(name string) (Inquirer, error) {
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := driver.(Inquirer)
+	if !ok {
+		return nil, unsupported(name, CapabilityInquiry)
+	}
+	return i, nil
+}
@@ -0,0 +1,46 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// purchaseOnlyDriver درایوری که فقط Purchase را پیاده‌سازی می‌کند
+type purchaseOnlyDriver struct{}
+
+func (purchaseOnlyDriver) GetName() string { return "purchase-only" }
+
+func (purchaseOnlyDriver) Purchase(context.Context, *TransactionRequest) (*PaymentResponse, error) {
+	return &PaymentResponse{}, nil
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	if got := CapabilitiesOf(purchaseOnlyDriver{}); !slices.Equal(got, []Capability{CapabilityPurchase}) {
+		t.Fatalf("purchase-only capabilities = %v", got)
+	}
+
+	full := &fakeDriver{calls: make(map[Operation]int)}
+	if Supports(full, CapabilityPartialRefund) {
+		t.Fatal("partial refund reported without SupportsPartialRefund")
+	}
+	full.partial = true
+	if got := CapabilitiesOf(full); !slices.Equal(got, allCapabilities) {
+		t.Fatalf("fake driver capabilities = %v, want all", got)
+	}
+}
+
+func TestClientAccessorsReportUnsupported(t *testing.T) {
+	c := newTestClient(t, []string{"zp"})
+	if _, err := c.Refunder("zp"); err != nil {
+		t.Fatalf("Refunder: %v", err)
+	}
+	_, err := c.PartialRefunder("zp")
+	if !errors.Is(err, ErrUnsupportedOperation) {
+		t.Fatalf("PartialRefunder err = %v, want ErrUnsupportedOperation", err)
+	}
+	if _, err := c.Settler("missing"); err == nil || errors.Is(err, ErrUnsupportedOperation) {
+		t.Fatalf("unknown driver err = %v, want a lookup error", err)
+	}
+}
@@ -0,0 +1,17 @@
+package gopay
+
+import "strings"
+
+// MaskCardNumber شماره کارت را به جز ۶ رقم اول و ۴ رقم آخر می‌پوشاند؛
+// شماره‌هایی که از قبل توسط درگاه پوشانده شده‌اند دست‌نخورده برمی‌گردند.
+func MaskCardNumber(pan string) string {
+	if len(pan) < 10 {
+		return pan
+	}
+	for _, r := range pan {
+		if r < '0' || r > '9' {
+			return pan
+		}
+	}
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
@@ -0,0 +1,16 @@
+package gopay
+
+import "testing"
+
+func TestMaskCardNumber(t *testing.T) {
+	tests := map[string]string{
+		"6037991234567890": "603799******7890",
+		"603799******7890": "603799******7890",
+		"123456789":        "123456789",
+	}
+	for pan, want := range tests {
+		if got := MaskCardNumber(pan); got != want {
+			t.Errorf("MaskCardNumber(%s) = %s, want %s", pan, got, want)
+		}
+	}
+}
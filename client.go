@@ -1,33 +1,3 @@
-//package gopay
-//
-//import (
-//	"fmt"
-//)
-//
-//type Client struct {
-//	factory *Factory
-//	config  *Config
-//}
-//
-//func NewClient(config *Config) *Client {
-//	return &Client{
-//		factory: NewFactory(),
-//		config:  config,
-//	}
-//}
-//
-//func (c *Client) Register(name string, initializer Initializer) {
-//	c.factory.RegisterDriver(name, initializer)
-//}
-//
-//func (c *Client) GetDriver(driverName string) (Driver, error) {
-//	driverConfig, ok := c.config.Drivers[driverName]
-//	if !ok {
-//		return nil, fmt.Errorf("configuration for driver '%s' not found", driverName)
-//	}
-//	return c.factory.New(driverName, driverConfig)
-//}
-
 package gopay
 
 import (
@@ -35,50 +5,101 @@ import (
 	"sync"
 )
 
-type InitializerFunc func(config DriverConfig) (Driver, error)
-
+// Client نمونه‌های درایور را بر اساس Config.Drivers به صورت تنبل (lazy) می‌سازد.
+// نام هر ورودی Config.Drivers نام نمونه است و نوع درایور از کلید "driver" خوانده می‌شود،
+// بنابراین می‌توان چند نمونه از یک نوع درایور (مثلاً دو ترمینال ملت) داشت.
 type Client struct {
 	config  *Config
 	drivers map[string]Driver
 	mu      sync.RWMutex
+
+	store       Store
+	idempotency IdempotencyStore
+	locker      Locker
+	orderIDs    OrderIDGenerator
+	retry       RetryPolicy
+
+	breakerConfig BreakerConfig
+	breakers      map[string]*CircuitBreaker
+	breakersMu    sync.Mutex
+}
+
+// Option تنظیمات اختیاری Client که به NewClient داده می‌شود
+type Option func(*Client)
+
+// WithStore لایه ذخیره‌سازی تراکنش‌ها را تعیین می‌کند (پیش‌فرض: MemoryStore)
+func WithStore(store Store) Option {
+	return func(c *Client) {
+		c.store = store
+	}
 }
 
-func NewClient(config *Config) *Client {
-	return &Client{
-		config:  config,
-		drivers: make(map[string]Driver),
+// NewClient پیکربندی تمام درایورها را با schema آن‌ها اعتبارسنجی می‌کند و
+// در صورت وجود خطا، همه مشکلات را با هم برمی‌گرداند.
+func NewClient(config *Config, opts ...Option) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	c := &Client{
+		config:      config,
+		drivers:     make(map[string]Driver),
+		store:       NewMemoryStore(),
+		idempotency: NewMemoryIdempotencyStore(),
+		locker:      NewMemoryLocker(),
+		retry:       DefaultRetryPolicy,
+
+		breakerConfig: DefaultBreakerConfig,
+		breakers:      make(map[string]*CircuitBreaker),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c, nil
 }
 
-func (c *Client) Register(name string, initializer InitializerFunc) error {
+// Store لایه ذخیره‌سازی تراکنش‌های Client را برمی‌گرداند
+func (c *Client) Store() Store {
+	return c.store
+}
+
+func (c *Client) GetDriver(name string) (Driver, error) {
+	c.mu.RLock()
+	driver, ok := c.drivers[name]
+	c.mu.RUnlock()
+	if ok {
+		return driver, nil
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if _, exists := c.drivers[name]; exists {
-		return fmt.Errorf("driver '%s' is already registered", name)
+	if driver, ok := c.drivers[name]; ok {
+		return driver, nil
 	}
 
 	driverConfig, ok := c.config.Drivers[name]
 	if !ok {
-		return fmt.Errorf("config for driver '%s' not found", name)
+		return nil, fmt.Errorf("config for driver '%s' not found", name)
+	}
+
+	reg, err := lookup(driverConfig.Type(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize driver '%s': %w", name, err)
 	}
 
-	driver, err := initializer(driverConfig)
+	driver, err = reg.initializer(reg.schema.WithDefaults(driverConfig))
 	if err != nil {
-		return fmt.Errorf("failed to initialize driver '%s': %w", name, err)
+		return nil, fmt.Errorf("failed to initialize driver '%s': %w", name, err)
 	}
+	c.prepare(driver)
 
 	c.drivers[name] = driver
-	return nil
+	return driver, nil
 }
 
-func (c *Client) GetDriver(name string) (Driver, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	driver, ok := c.drivers[name]
-	if !ok {
-		return nil, fmt.Errorf("driver '%s' not found or not registered", name)
+// prepare تنظیمات Client (مثل سیاست تکرار) را روی نمونه جدید درایور اعمال می‌کند
+func (c *Client) prepare(driver Driver) {
+	if configurable, ok := driver.(RetryConfigurable); ok {
+		configurable.SetRetryPolicy(c.retry)
 	}
-	return driver, nil
 }
@@ -1,7 +1,57 @@
 package gopay
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DriverTypeKey کلید رزروشده در DriverConfig برای تعیین نوع درایور ثبت‌شده
+const DriverTypeKey = "driver"
+
 type DriverConfig map[string]string
 
+// Type نوع درایور این پیکربندی را برمی‌گرداند؛ اگر کلید "driver" تنظیم نشده باشد
+// نام نمونه به عنوان نوع درایور در نظر گرفته می‌شود.
+func (c DriverConfig) Type(name string) string {
+	if t, ok := c[DriverTypeKey]; ok && t != "" {
+		return t
+	}
+	return name
+}
+
 type Config struct {
 	Drivers map[string]DriverConfig
 }
+
+// Validate پیکربندی تمام درایورها را با schema ثبت‌شده آن‌ها بررسی می‌کند
+func (c *Config) Validate() error {
+	names := make([]string, 0, len(c.Drivers))
+	for name := range c.Drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		driverConfig := c.Drivers[name]
+		reg, err := lookup(driverConfig.Type(name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("driver '%s': %w", name, err))
+			continue
+		}
+		if err := reg.schema.Validate(driverConfig); err != nil {
+			for _, e := range unwrapJoined(err) {
+				errs = append(errs, fmt.Errorf("driver '%s': %w", name, e))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func unwrapJoined(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"gopay"
+	"github.com/arminmiraftab/GoPay"
 	"io"
 	"net/http"
 	"strconv"
@@ -13,10 +14,22 @@ import (
 	"time"
 )
 
-// اصلاح شد: از InitializerFunc استفاده می‌کند
-var Initializer gopay.InitializerFunc = New
+func init() {
+	gopay.Register(driverName, New, Schema)
+	gopay.RegisterMessages(driverName, messages)
+}
+
+// Schema کلیدهای پیکربندی درایور به پرداخت ملت
+var Schema = gopay.ConfigSchema{
+	{Key: "terminal_id", Type: gopay.FieldInt, Required: true, Description: "Mellat terminal ID"},
+	{Key: "username", Type: gopay.FieldString, Required: true, Description: "Mellat web service username"},
+	{Key: "password", Type: gopay.FieldString, Required: true, Secret: true, Description: "Mellat web service password"},
+	{Key: "timeout", Type: gopay.FieldDuration, Default: "20s", Description: "HTTP client timeout"},
+}
 
 const (
+	driverName = "behpardakht_v1"
+
 	serviceURL = "https://pgwsf.bpm.bankmellat.ir/pgwchannel/services/pgw.asmx"
 	paymentURL = "https://bpm.shaparak.ir/pgwchannel/startpay.mellat"
 )
@@ -63,6 +76,30 @@ type bpSettleRequest struct {
 	SaleReferenceId int64    `xml:"soapenv:Body>com:bpSettleRequest>com:saleReferenceId"`
 }
 
+type bpReversalRequest struct {
+	XMLName         xml.Name `xml:"soapenv:Envelope"`
+	Soapenv         string   `xml:"xmlns:soapenv,attr"`
+	Com             string   `xml:"xmlns:com,attr"`
+	TerminalId      int64    `xml:"soapenv:Body>com:bpReversalRequest>com:terminalId"`
+	UserName        string   `xml:"soapenv:Body>com:bpReversalRequest>com:userName"`
+	UserPassword    string   `xml:"soapenv:Body>com:bpReversalRequest>com:userPassword"`
+	OrderId         int64    `xml:"soapenv:Body>com:bpReversalRequest>com:orderId"`
+	SaleOrderId     int64    `xml:"soapenv:Body>com:bpReversalRequest>com:saleOrderId"`
+	SaleReferenceId int64    `xml:"soapenv:Body>com:bpReversalRequest>com:saleReferenceId"`
+}
+
+type bpInquiryRequest struct {
+	XMLName         xml.Name `xml:"soapenv:Envelope"`
+	Soapenv         string   `xml:"xmlns:soapenv,attr"`
+	Com             string   `xml:"xmlns:com,attr"`
+	TerminalId      int64    `xml:"soapenv:Body>com:bpInquiryRequest>com:terminalId"`
+	UserName        string   `xml:"soapenv:Body>com:bpInquiryRequest>com:userName"`
+	UserPassword    string   `xml:"soapenv:Body>com:bpInquiryRequest>com:userPassword"`
+	OrderId         int64    `xml:"soapenv:Body>com:bpInquiryRequest>com:orderId"`
+	SaleOrderId     int64    `xml:"soapenv:Body>com:bpInquiryRequest>com:saleOrderId"`
+	SaleReferenceId int64    `xml:"soapenv:Body>com:bpInquiryRequest>com:saleReferenceId"`
+}
+
 // --- ساختارهای پاسخ (Response) ---
 
 type bpPayResponse struct {
@@ -92,6 +129,24 @@ type bpSettleResponse struct {
 	} `xml:"Body"`
 }
 
+type bpReversalResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		ReversalResponse struct {
+			Return string `xml:"return"` // فقط شامل ResCode
+		} `xml:"bpReversalRequestResponse"`
+	} `xml:"Body"`
+}
+
+type bpInquiryResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		InquiryResponse struct {
+			Return string `xml:"return"` // فقط شامل ResCode
+		} `xml:"bpInquiryRequestResponse"`
+	} `xml:"Body"`
+}
+
 // --- پیاده سازی درایور ---
 
 type Driver struct {
@@ -99,16 +154,22 @@ type Driver struct {
 	UserName     string
 	UserPassword string
 	Client       *http.Client
+	Retry        gopay.RetryPolicy
 }
 
 var _ gopay.Driver = (*Driver)(nil)
 var _ gopay.RedirectPayer = (*Driver)(nil)
+var _ gopay.UnitDeclarer = (*Driver)(nil)
+var _ gopay.CallbackIdentifier = (*Driver)(nil)
+var _ gopay.NumericOrderIDDriver = (*Driver)(nil)
+var _ gopay.Inquirer = (*Driver)(nil)
+var _ gopay.RefVerifier = (*Driver)(nil)
+var _ gopay.Settler = (*Driver)(nil)
+var _ gopay.Reverser = (*Driver)(nil)
+var _ gopay.RetrySafety = (*Driver)(nil)
+var _ gopay.RetryConfigurable = (*Driver)(nil)
 
 func New(config gopay.DriverConfig) (gopay.Driver, error) {
-	terminalIdStr, ok := config["terminal_id"]
-	if !ok {
-		return nil, fmt.Errorf("behpardakht config is missing 'terminal_id'")
-	}
 	username, ok := config["username"]
 	if !ok {
 		return nil, fmt.Errorf("behpardakht config is missing 'username'")
@@ -118,30 +179,66 @@ func New(config gopay.DriverConfig) (gopay.Driver, error) {
 		return nil, fmt.Errorf("behpardakht config is missing 'password'")
 	}
 
-	terminalId, err := strconv.ParseInt(terminalIdStr, 10, 64)
+	terminalId, err := config.Int64("terminal_id")
 	if err != nil {
 		return nil, fmt.Errorf("behpardakht config 'terminal_id' is invalid: %w", err)
 	}
+	timeout, err := config.Duration("timeout")
+	if err != nil {
+		return nil, fmt.Errorf("behpardakht config 'timeout' is invalid: %w", err)
+	}
+	if timeout == 0 {
+		timeout = 20 * time.Second
+	}
 
 	return &Driver{
 		TerminalId:   terminalId,
 		UserName:     username,
 		UserPassword: password,
-		Client:       &http.Client{},
+		Client:       &http.Client{Timeout: timeout},
 	}, nil
 }
 
 func (d *Driver) GetName() string {
-	return "behpardakht_v1"
+	return driverName
+}
+
+// RequiresNumericOrderID به پرداخت ملت شماره سفارش عددی و یکتا به ازای ترمینال می‌خواهد
+func (d *Driver) RequiresNumericOrderID() bool {
+	return true
+}
+
+// IsRetrySafe در به پرداخت ملت Verify، Settle، Reversal و استعلام با شماره سفارش یکسان idempotent هستند؛
+// تکرار bpPayRequest اما شماره سفارش تکراری (کد ۴۱) برمی‌گرداند.
+func (d *Driver) IsRetrySafe(op gopay.Operation) bool {
+	switch op {
+	case gopay.OpVerify, gopay.OpSettle, gopay.OpReverse, gopay.OpInquiry:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *Driver) SetRetryPolicy(policy gopay.RetryPolicy) {
+	d.Retry = policy
+}
+
+// AmountUnit به پرداخت ملت مبالغ را به ریال دریافت می‌کند
+func (d *Driver) AmountUnit() gopay.Unit {
+	return gopay.Rial
 }
 
 func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*gopay.PaymentResponse, error) {
 	now := time.Now()
 
-	// اصلاح شد: تبدیل IdempotencyKey (string) به OrderId (int64)
-	orderId, err := strconv.ParseInt(req.IdempotencyKey, 10, 64)
+	orderId, err := req.NumericOrderID()
 	if err != nil {
-		return nil, &gopay.GatewayError{Err: err, Message: "invalid OrderId (IdempotencyKey must be a valid int64 string)"}
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "invalid OrderId"}
+	}
+
+	amount, err := req.Amount.In(d.AmountUnit())
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidAmount, Err: err, Message: "invalid amount"}
 	}
 
 	soapReq := bpPayRequest{
@@ -151,7 +248,7 @@ func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*
 		UserName:       d.UserName,
 		UserPassword:   d.UserPassword,
 		OrderId:        orderId,
-		Amount:         req.Amount,
+		Amount:         amount,
 		LocalDate:      now.Format("20060102"),
 		LocalTime:      now.Format("150405"),
 		AdditionalData: req.Description,
@@ -163,86 +260,153 @@ func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*
 	// اصلاح شد: استفاده از تابع کمکی
 	err = d.callSOAP(ctx, "urn:bpPayRequest", soapReq, &soapResponse)
 	if err != nil {
-		return nil, &gopay.GatewayError{Err: err, Message: "failed to call purchase service"}
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: "failed to call purchase service"}
 	}
 
 	parts := strings.Split(soapResponse.Body.PayResponse.Return, ",")
 	if len(parts) != 2 {
-		return nil, &gopay.GatewayError{Message: fmt.Sprintf("invalid response from gateway: %s", soapResponse.Body.PayResponse.Return)}
+		return nil, &gopay.GatewayError{Driver: driverName, Message: fmt.Sprintf("invalid response from gateway: %s", soapResponse.Body.PayResponse.Return)}
 	}
 
 	resCode, _ := strconv.Atoi(parts[0])
 	refId := parts[1]
 
 	if resCode != 0 {
-		return nil, &gopay.GatewayError{Code: resCode, Message: behpardakhtStatusToMessage(resCode)}
+		return nil, behpardakhtError(resCode)
 	}
 
+	// کاربر باید به این آدرس POST شود با پارامتر RefId
 	return &gopay.PaymentResponse{
-		Authority:  refId,
-		PaymentURL: paymentURL, // کاربر باید به این آدرس POST شود با پارامتر RefId
+		Authority:      refId,
+		OrderID:        strconv.FormatInt(orderId, 10),
+		PaymentURL:     paymentURL,
+		RedirectMethod: gopay.RedirectPOST,
+		RedirectParams: map[string]string{
+			"RefId": refId,
+		},
 	}, nil
 }
 
+// CallbackKey کلید تراکنش (SaleOrderId) را از callback به پرداخت برمی‌گرداند
+func (d *Driver) CallbackKey(r *http.Request) string {
+	return r.FormValue("SaleOrderId")
+}
+
 func (d *Driver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher gopay.TransactionFetcher) (*gopay.VerificationResponse, error) {
 	if err := r.ParseForm(); err != nil {
-		return nil, &gopay.GatewayError{Err: err, Message: "failed to parse callback form"}
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to parse callback form"}
 	}
 
 	resCodeStr := r.FormValue("ResCode")
 	saleReferenceIdStr := r.FormValue("SaleReferenceId")
-	saleOrderIdStr := r.FormValue("SaleOrderId") // این همان OrderId (IdempotencyKey) شماست
+	saleOrderIdStr := r.FormValue("SaleOrderId") // این همان OrderId ارسال‌شده در Purchase است
 
 	resCode, _ := strconv.Atoi(resCodeStr)
 
 	if resCode != 0 {
-		return &gopay.VerificationResponse{Status: gopay.StatusFailed},
-			&gopay.GatewayError{Code: resCode, Message: behpardakhtStatusToMessage(resCode)}
+		err := behpardakhtError(resCode)
+		status := gopay.StatusFailed
+		if errors.Is(err, gopay.ErrUserCancelled) {
+			status = gopay.StatusCancelled
+		}
+		return &gopay.VerificationResponse{Status: status, Message: err.Message}, err
 	}
 
 	// اصلاح شد: خطای fetcher مدیریت می‌شود
 	original, err := fetcher(ctx, saleOrderIdStr) // در به پرداخت، کلید شما SaleOrderId است
 	if err != nil {
-		return nil, &gopay.GatewayError{Err: err, Message: "failed to fetch original transaction"}
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to fetch original transaction"}
 	}
 
-	// !! نقص امنیتی که قبلاً بحث شد در اینجا قرار دارد !!
-	// شما باید 'original.Amount' را بررسی کنید
-	// if original.Amount != ??? { // مبلغی که انتظار داشتید
-	// 	 return &gopay.VerificationResponse{Status: gopay.StatusAmountMismatch}, nil
-	// }
-	_ = original // برای جلوگیری از خطای "declared and not used"
-
 	saleOrderId, err := strconv.ParseInt(saleOrderIdStr, 10, 64)
 	if err != nil {
-		return nil, &gopay.GatewayError{Err: err, Message: "invalid SaleOrderId returned from gateway"}
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "invalid SaleOrderId returned from gateway"}
 	}
 
 	saleReferenceId, err := strconv.ParseInt(saleReferenceIdStr, 10, 64)
 	if err != nil {
-		return nil, &gopay.GatewayError{Err: err, Message: "invalid SaleReferenceId returned from gateway"}
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "invalid SaleReferenceId returned from gateway"}
+	}
+
+	// بررسی تطابق مبلغ: مبلغ پرداخت‌شده (FinalAmount) باید با مبلغ سفارش یکی باشد.
+	// در صورت عدم تطابق، تراکنش Settle نمی‌شود و به حساب دارنده کارت برگشت داده می‌شود.
+	// استعلام ملت مبلغ را برنمی‌گرداند، پس callback بدون FinalAmount معتبر هم قابل
+	// بررسی نیست و مانند مغایرت برگشت داده می‌شود.
+	finalAmountStr := r.FormValue("FinalAmount")
+	finalAmount, parseErr := strconv.ParseInt(finalAmountStr, 10, 64)
+	if parseErr != nil || !gopay.Rials(finalAmount).Equal(original.Amount) {
+		reversal, err := d.reverse(ctx, saleOrderId, saleReferenceId)
+		if parseErr != nil {
+			err = errors.Join(&gopay.GatewayError{
+				Driver:  driverName,
+				Kind:    gopay.ErrAmountMismatch,
+				Err:     parseErr,
+				Message: "callback FinalAmount is missing or invalid, paid amount cannot be confirmed",
+			}, err)
+		}
+		return &gopay.VerificationResponse{
+			Status:      gopay.StatusAmountMismatch,
+			ReferenceID: saleReferenceIdStr,
+			Message:     reversal.Message,
+			FailedStage: gopay.OpVerify,
+			Reversal:    reversal,
+			OriginalData: map[string]interface{}{
+				"SaleOrderId":    saleOrderId,
+				"ExpectedAmount": original.Amount,
+				"FinalAmount":    finalAmountStr,
+			},
+		}, err
 	}
 
-	// مرحله Verify
+	// مرحله Verify؛ تراکنش تأییدنشده را بانک خودکار برگشت می‌زند، پس برگشت لازم نیست
 	verifyResCode, err := d.callVerify(ctx, saleOrderId, saleReferenceId)
 	if err != nil {
-		return nil, err // خطا در اتصال
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed, ReferenceID: saleReferenceIdStr, FailedStage: gopay.OpVerify}, err
 	}
 
-	if verifyResCode != 0 {
-		return &gopay.VerificationResponse{Status: gopay.StatusFailed},
-			&gopay.GatewayError{Code: verifyResCode, Message: behpardakhtStatusToMessage(verifyResCode)}
+	if verifyResCode != 0 && verifyResCode != 43 {
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed, ReferenceID: saleReferenceIdStr, FailedStage: gopay.OpVerify},
+			behpardakhtError(verifyResCode)
 	}
 
-	// مرحله Settle
+	// مرحله Settle (با سیاست تکرار). اگر نتیجه تسویه معلوم نباشد (خطای شبکه، خطای
+	// سامانه بانک یا کد ناشناخته) تراکنش در verified می‌ماند تا Reconciler آن را تسویه
+	// کند؛ برگشت زدن تراکنشی که شاید تسویه شده باشد وجه را دوبار جابه‌جا می‌کند.
 	settleResCode, err := d.callSettle(ctx, saleOrderId, saleReferenceId)
+	if err == nil && settleResCode != 0 && settleResCode != 45 && !isDefinitiveRejection(settleResCode) {
+		err = behpardakhtError(settleResCode)
+	}
 	if err != nil {
-		return nil, err // خطا در اتصال
+		return &gopay.VerificationResponse{
+			Status:      gopay.StatusFailed,
+			ReferenceID: saleReferenceIdStr,
+			FailedStage: gopay.OpSettle,
+			OriginalData: map[string]interface{}{
+				"SaleOrderId":   saleOrderId,
+				"SettleResCode": settleResCode,
+			},
+		}, err
 	}
 
-	if settleResCode != 0 {
-		return &gopay.VerificationResponse{Status: gopay.StatusFailed},
-			&gopay.GatewayError{Code: settleResCode, Message: behpardakhtStatusToMessage(settleResCode)}
+	// بانک تسویه را صریحاً رد کرده است، پس تراکنش تأییدشده برگشت داده می‌شود تا وجه بلاتکلیف نماند
+	if settleResCode != 0 && settleResCode != 45 {
+		err = behpardakhtError(settleResCode)
+		reversal, reverseErr := d.reverse(ctx, saleOrderId, saleReferenceId)
+		status := gopay.StatusFailed
+		if reversal.Reversed {
+			status = gopay.StatusReversed
+		}
+		return &gopay.VerificationResponse{
+			Status:      status,
+			ReferenceID: saleReferenceIdStr,
+			Message:     reversal.Message,
+			FailedStage: gopay.OpSettle,
+			Reversal:    reversal,
+			OriginalData: map[string]interface{}{
+				"SaleOrderId":   saleOrderId,
+				"SettleResCode": settleResCode,
+			},
+		}, errors.Join(err, reverseErr)
 	}
 
 	return &gopay.VerificationResponse{
@@ -268,15 +432,220 @@ func (d *Driver) callVerify(ctx context.Context, orderId int64, saleReferenceId
 	}
 
 	var soapResponse bpVerifyResponse
-	err := d.callSOAP(ctx, "urn:bpVerifyRequest", soapReq, &soapResponse)
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpVerify, func(ctx context.Context) error {
+		if err := d.callSOAP(ctx, "urn:bpVerifyRequest", soapReq, &soapResponse); err != nil {
+			return &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: "failed to call verify service"}
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return parseResCode(soapResponse.Body.VerifyResponse.Return)
+}
+
+// Verify مرحله bpVerifyRequest را جداگانه انجام می‌دهد (مثلاً برای Reconciler)
+func (d *Driver) Verify(ctx context.Context, ref *gopay.TransactionRef) (*gopay.VerificationResponse, error) {
+	orderId, saleReferenceId, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	resCode, err := d.callVerify(ctx, orderId, saleReferenceId)
+	if err != nil {
+		return nil, err
+	}
+	switch resCode {
+	case 0:
+		return &gopay.VerificationResponse{Status: gopay.StatusSuccess, ReferenceID: ref.ReferenceID}, nil
+	case 43:
+		return &gopay.VerificationResponse{Status: gopay.StatusAlreadyVerified, ReferenceID: ref.ReferenceID}, nil
+	default:
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed, ReferenceID: ref.ReferenceID, FailedStage: gopay.OpVerify},
+			behpardakhtError(resCode)
+	}
+}
+
+// Settle مرحله bpSettleRequest را برای تراکنش تأییدشده انجام می‌دهد. تراکنشی که
+// تسویه نشود پس از مدتی توسط بانک به دارنده کارت برگشت داده می‌شود.
+func (d *Driver) Settle(ctx context.Context, ref *gopay.TransactionRef) (*gopay.VerificationResponse, error) {
+	orderId, saleReferenceId, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	resCode, err := d.callSettle(ctx, orderId, saleReferenceId)
+	if err != nil {
+		return nil, err
+	}
+	switch resCode {
+	case 0:
+		return &gopay.VerificationResponse{Status: gopay.StatusSuccess, ReferenceID: ref.ReferenceID}, nil
+	case 45:
+		return &gopay.VerificationResponse{Status: gopay.StatusAlreadyVerified, ReferenceID: ref.ReferenceID}, nil
+	default:
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed, ReferenceID: ref.ReferenceID, FailedStage: gopay.OpSettle},
+			behpardakhtError(resCode)
+	}
+}
+
+// Reverse تراکنش تأییدشده ولی تسویه‌نشده را با bpReversalRequest برگشت می‌زند
+func (d *Driver) Reverse(ctx context.Context, ref *gopay.TransactionRef) (*gopay.VerificationResponse, error) {
+	orderId, saleReferenceId, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	reversal, err := d.reverse(ctx, orderId, saleReferenceId)
+	if err != nil {
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed, ReferenceID: ref.ReferenceID, FailedStage: gopay.OpReverse, Reversal: reversal}, err
+	}
+	return &gopay.VerificationResponse{
+		Status:      gopay.StatusReversed,
+		ReferenceID: ref.ReferenceID,
+		Message:     reversal.Message,
+		Reversal:    reversal,
+	}, nil
+}
+
+// reverse برگشت را انجام می‌دهد و نتیجه را (حتی در صورت خطا) برمی‌گرداند؛
+// کد ۴۸ یعنی تراکنش قبلاً برگشت خورده است
+func (d *Driver) reverse(ctx context.Context, orderId int64, saleReferenceId int64) (*gopay.ReversalResult, error) {
+	resCode, err := d.callReversal(ctx, orderId, saleReferenceId)
 	if err != nil {
-		return -1, &gopay.GatewayError{Err: err, Message: "failed to call verify service"}
+		return &gopay.ReversalResult{Message: "reversal request failed"}, err
+	}
+	result := &gopay.ReversalResult{
+		Reversed: resCode == 0 || resCode == 48,
+		Code:     strconv.Itoa(resCode),
+		Message:  behpardakhtStatusToMessage(resCode),
 	}
+	if !result.Reversed {
+		return result, behpardakhtError(resCode)
+	}
+	return result, nil
+}
 
-	resCode, _ := strconv.Atoi(soapResponse.Body.VerifyResponse.Return)
+// isDefinitiveRejection بیان می‌کند که کد پاسخ، رد قطعی درخواست توسط بانک است؛
+// کدهای ناشناخته و خطاهای سامانه بانک نتیجه نامعلوم دارند
+func isDefinitiveRejection(code int) bool {
+	kind := behpardakhtStatusToKind(code)
+	return kind != nil && !errors.Is(kind, gopay.ErrGatewayUnavailable)
+}
+
+// parseResCode مقدار return پاسخ SOAP را به کد عددی تبدیل می‌کند؛ پاسخ غیرعددی
+// نتیجه نامعلوم است و مانند خطای درگاه با ErrGatewayUnavailable برچسب می‌خورد
+func parseResCode(raw string) (int, error) {
+	resCode, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return -1, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: fmt.Sprintf("unexpected response code %q", raw)}
+	}
 	return resCode, nil
 }
 
+// parseRef شماره سفارش و SaleReferenceId عددی را از ref استخراج می‌کند
+func parseRef(ref *gopay.TransactionRef) (int64, int64, error) {
+	orderId, err := strconv.ParseInt(ref.OrderID, 10, 64)
+	if err != nil {
+		return 0, 0, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Err: err, Message: "invalid OrderId"}
+	}
+	saleReferenceId, err := strconv.ParseInt(ref.ReferenceID, 10, 64)
+	if err != nil {
+		return 0, 0, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Err: err, Message: "SaleReferenceId is required"}
+	}
+	return orderId, saleReferenceId, nil
+}
+
+// Inquire وضعیت تراکنش را با bpInquiryRequest استعلام می‌کند. پاسخ صفر یعنی تراکنش
+// تأیید شده است؛ این سرویس مبلغ را برنمی‌گرداند.
+//
+// اگر callback نرسیده باشد ref.ReferenceID خالی است و استعلام فقط با شماره سفارش
+// (SaleReferenceId صفر) انجام می‌شود. بدون SaleReferenceId نمی‌توان تراکنش را تأیید یا
+// تسویه کرد و بانک پرداخت تأییدنشده را خودکار برگشت می‌زند، پس پرداخت انجام‌شده
+// StatusPending برمی‌گرداند تا پس از انقضا ناموفق ثبت شود.
+func (d *Driver) Inquire(ctx context.Context, ref *gopay.TransactionRef) (*gopay.InquiryResponse, error) {
+	orderId, err := strconv.ParseInt(ref.OrderID, 10, 64)
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Err: err, Message: "invalid OrderId"}
+	}
+	var saleReferenceId int64
+	if ref.ReferenceID != "" {
+		if _, saleReferenceId, err = parseRef(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	resCode, err := d.callInquiry(ctx, orderId, saleReferenceId)
+	if err != nil {
+		return nil, err
+	}
+
+	status := inquiryCodeToStatus(resCode)
+	if status == gopay.StatusPending {
+		return nil, behpardakhtError(resCode)
+	}
+	message := behpardakhtStatusToMessage(resCode)
+	if saleReferenceId == 0 && (status == gopay.StatusSuccess || status == gopay.StatusAlreadyVerified) {
+		status = gopay.StatusPending
+		message = "پرداخت بدون SaleReferenceId قابل تأیید نیست و توسط بانک برگشت داده می‌شود"
+	}
+	return &gopay.InquiryResponse{
+		Status:      status,
+		ReferenceID: ref.ReferenceID,
+		Message:     message,
+		OriginalData: map[string]interface{}{
+			"SaleOrderId": orderId,
+			"ResCode":     resCode,
+		},
+	}, nil
+}
+
+// تابع کمکی برای فراخوانی Inquiry
+func (d *Driver) callInquiry(ctx context.Context, orderId int64, saleReferenceId int64) (int, error) {
+	soapReq := bpInquiryRequest{
+		Soapenv:         "http://schemas.xmlsoap.org/soap/envelope/",
+		Com:             "http://interfaces.core.sw.bps.com/",
+		TerminalId:      d.TerminalId,
+		UserName:        d.UserName,
+		UserPassword:    d.UserPassword,
+		OrderId:         orderId,
+		SaleOrderId:     orderId,
+		SaleReferenceId: saleReferenceId,
+	}
+
+	var soapResponse bpInquiryResponse
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpInquiry, func(ctx context.Context) error {
+		if err := d.callSOAP(ctx, "urn:bpInquiryRequest", soapReq, &soapResponse); err != nil {
+			return &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: "failed to call inquiry service"}
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return parseResCode(soapResponse.Body.InquiryResponse.Return)
+}
+
+// inquiryCodeToStatus کد پاسخ bpInquiryRequest را به وضعیت نرمال‌شده تبدیل می‌کند.
+// کد ۴۶ (تسویه‌نشده) StatusSuccess است تا تراکنش دوباره تأیید (با نتیجه ۴۳) و سپس
+// تسویه یا برگشت شود. کدهای خطای سامانه بانک StatusPending برمی‌گردانند چون وضعیت
+// تراکنش معلوم نیست.
+func inquiryCodeToStatus(code int) gopay.VerificationStatus {
+	switch code {
+	case 0, 43, 45:
+		return gopay.StatusAlreadyVerified
+	case 46:
+		return gopay.StatusSuccess
+	case 48:
+		return gopay.StatusReversed
+	case 17:
+		return gopay.StatusCancelled
+	}
+	if errors.Is(behpardakhtStatusToKind(code), gopay.ErrGatewayUnavailable) {
+		return gopay.StatusPending
+	}
+	return gopay.StatusFailed
+}
+
 // تابع کمکی برای فراخوانی Settle (کامل شد)
 func (d *Driver) callSettle(ctx context.Context, orderId int64, saleReferenceId int64) (int, error) {
 	soapReq := bpSettleRequest{
@@ -291,13 +660,44 @@ func (d *Driver) callSettle(ctx context.Context, orderId int64, saleReferenceId
 	}
 
 	var soapResponse bpSettleResponse
-	err := d.callSOAP(ctx, "urn:bpSettleRequest", soapReq, &soapResponse)
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpSettle, func(ctx context.Context) error {
+		if err := d.callSOAP(ctx, "urn:bpSettleRequest", soapReq, &soapResponse); err != nil {
+			return &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: "failed to call settle service"}
+		}
+		return nil
+	})
 	if err != nil {
-		return -1, &gopay.GatewayError{Err: err, Message: "failed to call settle service"}
+		return -1, err
 	}
 
-	resCode, _ := strconv.Atoi(soapResponse.Body.SettleResponse.Return)
-	return resCode, nil
+	return parseResCode(soapResponse.Body.SettleResponse.Return)
+}
+
+// تابع کمکی برای فراخوانی Reversal (برگشت وجه به دارنده کارت)
+func (d *Driver) callReversal(ctx context.Context, orderId int64, saleReferenceId int64) (int, error) {
+	soapReq := bpReversalRequest{
+		Soapenv:         "http://schemas.xmlsoap.org/soap/envelope/",
+		Com:             "http://interfaces.core.sw.bps.com/",
+		TerminalId:      d.TerminalId,
+		UserName:        d.UserName,
+		UserPassword:    d.UserPassword,
+		OrderId:         orderId,
+		SaleOrderId:     orderId,
+		SaleReferenceId: saleReferenceId,
+	}
+
+	var soapResponse bpReversalResponse
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpReverse, func(ctx context.Context) error {
+		if err := d.callSOAP(ctx, "urn:bpReversalRequest", soapReq, &soapResponse); err != nil {
+			return &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: "failed to call reversal service"}
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return parseResCode(soapResponse.Body.ReversalResponse.Return)
 }
 
 // callSOAP تابع کمکی جدید برای جلوگیری از تکرار کد
@@ -339,44 +739,70 @@ func (d *Driver) callSOAP(ctx context.Context, soapAction string, reqBody interf
 	return nil
 }
 
-// تابع ترجمه خطاها
-func behpardakhtStatusToMessage(status int) string {
+// behpardakhtError کد پاسخ به پرداخت را به GatewayError با دسته‌بندی نرمال‌شده تبدیل می‌کند
+func behpardakhtError(code int) *gopay.GatewayError {
+	return &gopay.GatewayError{
+		Driver:  driverName,
+		Code:    code,
+		Kind:    behpardakhtStatusToKind(code),
+		Message: behpardakhtStatusToMessage(code),
+	}
+}
+
+func behpardakhtStatusToKind(status int) error {
 	switch status {
-	case 0:
-		return "تراکنش با موفقیت انجام شد"
-	case 11:
-		return "شماره کارت نامعتبر است"
+	case 11, 13, 14, 15, 16, 18, 19, 111, 112, 113, 114:
+		return gopay.ErrInvalidCard
 	case 12:
-		return "موجودی کافی نیست"
-	case 13:
-		return "رمز نادرست است"
-	case 14:
-		return "تعداد دفعات وارد کردن رمز بیش از حد مجاز است"
-	case 15:
-		return "کارت نامعتبر است"
+		return gopay.ErrInsufficientFunds
 	case 17:
-		return "کاربر از انجام تراکنش منصرف شده است"
-	case 18:
-		return "تاریخ انقضای کارت گذشته است"
-	case 21:
-		return "پذیرنده نامعتبر است"
-	case 41:
-		return "شماره درخواست تکراری است"
-	case 43:
-		return "قبلا درخواست Verify داده شده است"
-	case 45:
-		return "تراکنش Settle شده است"
-	case 46:
-		return "تراکنش Settle نشده است"
-	case 51:
-		return "تراکنش تکراری است"
-	case 54:
-		return "تراکنش مرجع موجود نیست"
-	case 55:
-		return "تراکنش نامعتبر است"
-	case 61:
-		return "خطا در واریز"
+		return gopay.ErrUserCancelled
+	case 21, 23, 24:
+		return gopay.ErrAuthFailed
+	case 25:
+		return gopay.ErrInvalidAmount
+	case 41, 51:
+		return gopay.ErrDuplicateOrder
+	case 43, 45:
+		return gopay.ErrAlreadyVerified
+	case 42, 46, 47, 48, 54, 55:
+		return gopay.ErrInvalidTransaction
+	case 34, 61, 415, 417, 418:
+		return gopay.ErrGatewayUnavailable
+	case 421:
+		return gopay.ErrIPNotWhitelisted
 	default:
-		return fmt.Sprintf("خطای ناشناخته با کد: %d", status)
+		return nil
+	}
+}
+
+// messages پیام‌های دوزبانه کدهای پاسخ به پرداخت که در init() در کاتالوگ gopay ثبت می‌شوند
+var messages = map[string]gopay.Messages{
+	"0":   {gopay.LangFa: "تراکنش با موفقیت انجام شد", gopay.LangEn: "Transaction completed successfully"},
+	"11":  {gopay.LangFa: "شماره کارت نامعتبر است", gopay.LangEn: "Invalid card number"},
+	"12":  {gopay.LangFa: "موجودی کافی نیست", gopay.LangEn: "Insufficient funds"},
+	"13":  {gopay.LangFa: "رمز نادرست است", gopay.LangEn: "Incorrect PIN"},
+	"14":  {gopay.LangFa: "تعداد دفعات وارد کردن رمز بیش از حد مجاز است", gopay.LangEn: "PIN retry limit exceeded"},
+	"15":  {gopay.LangFa: "کارت نامعتبر است", gopay.LangEn: "Invalid card"},
+	"17":  {gopay.LangFa: "کاربر از انجام تراکنش منصرف شده است", gopay.LangEn: "User cancelled the transaction"},
+	"18":  {gopay.LangFa: "تاریخ انقضای کارت گذشته است", gopay.LangEn: "Card has expired"},
+	"21":  {gopay.LangFa: "پذیرنده نامعتبر است", gopay.LangEn: "Invalid merchant"},
+	"41":  {gopay.LangFa: "شماره درخواست تکراری است", gopay.LangEn: "Duplicate order ID"},
+	"43":  {gopay.LangFa: "قبلا درخواست Verify داده شده است", gopay.LangEn: "Verify has already been requested"},
+	"45":  {gopay.LangFa: "تراکنش Settle شده است", gopay.LangEn: "Transaction has been settled"},
+	"46":  {gopay.LangFa: "تراکنش Settle نشده است", gopay.LangEn: "Transaction has not been settled"},
+	"48":  {gopay.LangFa: "تراکنش Reverse شده است", gopay.LangEn: "Transaction has been reversed"},
+	"51":  {gopay.LangFa: "تراکنش تکراری است", gopay.LangEn: "Duplicate transaction"},
+	"54":  {gopay.LangFa: "تراکنش مرجع موجود نیست", gopay.LangEn: "Reference transaction does not exist"},
+	"55":  {gopay.LangFa: "تراکنش نامعتبر است", gopay.LangEn: "Invalid transaction"},
+	"61":  {gopay.LangFa: "خطا در واریز", gopay.LangEn: "Deposit error"},
+	"421": {gopay.LangFa: "IP نامعتبر است", gopay.LangEn: "Invalid IP address"},
+}
+
+// تابع ترجمه خطاها
+func behpardakhtStatusToMessage(status int) string {
+	if text, ok := gopay.DefaultCatalog.CodeMessage(driverName, strconv.Itoa(status), gopay.LangFa); ok {
+		return text
 	}
+	return fmt.Sprintf("خطای ناشناخته با کد: %d", status)
 }
@@ -0,0 +1,235 @@
+package behpardakht_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arminmiraftab/GoPay"
+)
+
+// fakeBank پاسخ هر SOAPAction را از codes برمی‌گرداند و فراخوانی‌ها را ثبت می‌کند
+type fakeBank struct {
+	mu    sync.Mutex
+	codes map[string]string
+	calls []string
+}
+
+func (b *fakeBank) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("SOAPAction"), "urn:")
+	b.mu.Lock()
+	b.calls = append(b.calls, action)
+	code, ok := b.codes[action]
+	b.mu.Unlock()
+	if !ok {
+		http.Error(w, "unexpected action "+action, http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, `<Envelope><Body><%[1]sResponse><return>%[2]s</return></%[1]sResponse></Body></Envelope>`, action, code)
+}
+
+func (b *fakeBank) called(action string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.calls {
+		if c == action {
+			return true
+		}
+	}
+	return false
+}
+
+// redirect همه درخواست‌ها را به سرور تست می‌فرستد
+type redirect struct{ target *url.URL }
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestDriver(t *testing.T, codes map[string]string) (*Driver, *fakeBank) {
+	t.Helper()
+	bank := &fakeBank{codes: codes}
+	srv := httptest.NewServer(bank)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	return &Driver{
+		TerminalId:   1,
+		UserName:     "user",
+		UserPassword: "pass",
+		Client:       &http.Client{Transport: redirect{target}},
+		Retry:        gopay.RetryPolicy{MaxAttempts: 1},
+	}, bank
+}
+
+func callback(fields map[string]string) *http.Request {
+	form := url.Values{"ResCode": {"0"}, "SaleOrderId": {"1001"}, "SaleReferenceId": {"5005"}}
+	for k, v := range fields {
+		if v == "" {
+			form.Del(k)
+			continue
+		}
+		form.Set(k, v)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func fetcher(amount gopay.Money) gopay.TransactionFetcher {
+	return func(context.Context, string) (*gopay.OriginalTransaction, error) {
+		return &gopay.OriginalTransaction{Amount: amount}, nil
+	}
+}
+
+func TestVerifyAndConfirmSettlesMatchingAmount(t *testing.T) {
+	d, bank := newTestDriver(t, map[string]string{"bpVerifyRequest": "0", "bpSettleRequest": "0"})
+
+	resp, err := d.VerifyAndConfirm(context.Background(), callback(map[string]string{"FinalAmount": "10000"}), fetcher(gopay.Rials(10000)))
+	if err != nil {
+		t.Fatalf("VerifyAndConfirm: %v", err)
+	}
+	if resp.Status != gopay.StatusSuccess || resp.ReferenceID != "5005" {
+		t.Fatalf("got status %v ref %q", resp.Status, resp.ReferenceID)
+	}
+	if bank.called("bpReversalRequest") {
+		t.Fatal("matching payment was reversed")
+	}
+}
+
+func TestVerifyAndConfirmReversesAmountMismatch(t *testing.T) {
+	d, bank := newTestDriver(t, map[string]string{"bpReversalRequest": "0"})
+
+	resp, err := d.VerifyAndConfirm(context.Background(), callback(map[string]string{"FinalAmount": "9000"}), fetcher(gopay.Rials(10000)))
+	if err != nil {
+		t.Fatalf("VerifyAndConfirm: %v", err)
+	}
+	if resp.Status != gopay.StatusAmountMismatch || resp.Reversal == nil || !resp.Reversal.Reversed {
+		t.Fatalf("got status %v reversal %+v", resp.Status, resp.Reversal)
+	}
+	if bank.called("bpVerifyRequest") || bank.called("bpSettleRequest") {
+		t.Fatalf("mismatched payment reached verify/settle: %v", bank.calls)
+	}
+}
+
+func TestVerifyAndConfirmFailsClosedWithoutFinalAmount(t *testing.T) {
+	for name, finalAmount := range map[string]string{"missing": "", "invalid": "abc"} {
+		t.Run(name, func(t *testing.T) {
+			d, bank := newTestDriver(t, map[string]string{"bpReversalRequest": "0"})
+
+			resp, err := d.VerifyAndConfirm(context.Background(), callback(map[string]string{"FinalAmount": finalAmount}), fetcher(gopay.Rials(10000)))
+			if !errors.Is(err, gopay.ErrAmountMismatch) {
+				t.Fatalf("err = %v, want ErrAmountMismatch", err)
+			}
+			if resp == nil || resp.Status != gopay.StatusAmountMismatch || !resp.Reversal.Reversed {
+				t.Fatalf("got %+v", resp)
+			}
+			if bank.called("bpSettleRequest") {
+				t.Fatal("unconfirmed amount was settled")
+			}
+		})
+	}
+}
+
+func TestInquireMapsUnsettledToSuccess(t *testing.T) {
+	tests := map[string]gopay.VerificationStatus{
+		"0":  gopay.StatusAlreadyVerified,
+		"43": gopay.StatusAlreadyVerified,
+		"45": gopay.StatusAlreadyVerified,
+		"46": gopay.StatusSuccess,
+		"48": gopay.StatusReversed,
+		"17": gopay.StatusCancelled,
+	}
+	for code, want := range tests {
+		d, _ := newTestDriver(t, map[string]string{"bpInquiryRequest": code})
+		resp, err := d.Inquire(context.Background(), &gopay.TransactionRef{OrderID: "1001", ReferenceID: "5005"})
+		if err != nil {
+			t.Fatalf("code %s: %v", code, err)
+		}
+		if resp.Status != want {
+			t.Errorf("code %s: status %v, want %v", code, resp.Status, want)
+		}
+	}
+}
+
+func TestInquireWithOrderIDOnly(t *testing.T) {
+	d, _ := newTestDriver(t, map[string]string{"bpInquiryRequest": "0"})
+	resp, err := d.Inquire(context.Background(), &gopay.TransactionRef{OrderID: "1001"})
+	if err != nil {
+		t.Fatalf("Inquire: %v", err)
+	}
+	// بدون SaleReferenceId تأیید ممکن نیست؛ تراکنش منتظر انقضا می‌ماند
+	if resp.Status != gopay.StatusPending {
+		t.Fatalf("status = %v, want pending", resp.Status)
+	}
+
+	d, _ = newTestDriver(t, map[string]string{"bpInquiryRequest": "17"})
+	if resp, err := d.Inquire(context.Background(), &gopay.TransactionRef{OrderID: "1001"}); err != nil || resp.Status != gopay.StatusCancelled {
+		t.Fatalf("got %+v, %v; want cancelled", resp, err)
+	}
+}
+
+func TestSettleFailureReversesOnlyDefinitiveRejections(t *testing.T) {
+	tests := map[string]struct {
+		settle  string // خالی یعنی خطای انتقال
+		reverse bool
+	}{
+		"rejected":        {settle: "42", reverse: true},
+		"bank error":      {settle: "415"},
+		"unknown code":    {settle: "999"},
+		"garbled":         {settle: "<html>"},
+		"transport error": {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			codes := map[string]string{"bpVerifyRequest": "0", "bpReversalRequest": "0"}
+			if tt.settle != "" {
+				codes["bpSettleRequest"] = tt.settle
+			}
+			d, bank := newTestDriver(t, codes)
+
+			resp, err := d.VerifyAndConfirm(context.Background(), callback(map[string]string{"FinalAmount": "10000"}), fetcher(gopay.Rials(10000)))
+			if err == nil {
+				t.Fatal("settle failure returned no error")
+			}
+			if resp == nil || resp.FailedStage != gopay.OpSettle || resp.ReferenceID != "5005" {
+				t.Fatalf("got %+v", resp)
+			}
+			if got := bank.called("bpReversalRequest"); got != tt.reverse {
+				t.Fatalf("reversal called = %v, want %v", got, tt.reverse)
+			}
+			if !tt.reverse && (resp.Reversal != nil || resp.Status != gopay.StatusFailed) {
+				t.Fatalf("ambiguous settle result was not left verified: %+v", resp)
+			}
+			if tt.reverse && resp.Status != gopay.StatusReversed {
+				t.Fatalf("status = %v, want reversed", resp.Status)
+			}
+		})
+	}
+}
+
+func TestCallbackHandlerReportsCancelledPayment(t *testing.T) {
+	c, err := gopay.NewClient(&gopay.Config{Drivers: map[string]gopay.DriverConfig{
+		"mellat": {gopay.DriverTypeKey: driverName, "terminal_id": "1", "username": "user", "password": "pass"},
+	}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	var cancelled *gopay.CallbackResult
+	h := gopay.NewCallbackHandler(c, fetcher(gopay.Rials(10000)), gopay.CallbackHooks{
+		OnCancelled: func(w http.ResponseWriter, r *http.Request, result *gopay.CallbackResult) { cancelled = result },
+	})
+
+	r := callback(map[string]string{"ResCode": "17", "SaleReferenceId": ""})
+	r.URL.Path = "/callback/mellat"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if cancelled == nil || cancelled.Response.Status != gopay.StatusCancelled || !errors.Is(cancelled.Err, gopay.ErrUserCancelled) {
+		t.Fatalf("OnCancelled result = %+v", cancelled)
+	}
+}
@@ -4,18 +4,51 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"gopay"
+	"github.com/arminmiraftab/GoPay"
 	"io"
 	"net/http"
 	"strconv"
 	"time"
 )
 
+func init() {
+	gopay.Register(driverName, NewFanava, Schema)
+	gopay.RegisterMessages(driverName, messages)
+}
+
+// messages پیام‌های دوزبانه مقادیر Result فن‌آوا که در کاتالوگ gopay ثبت می‌شوند
+var messages = map[string]gopay.Messages{
+	"erSucceed":                    {gopay.LangFa: "عملیات موفق", gopay.LangEn: "Success"},
+	"erAAS_UseridOrPassIsRequired": {gopay.LangFa: "نام کاربری یا رمز عبور ارسال نشده است", gopay.LangEn: "User ID or password is required"},
+	"erAAS_InvalidUseridOrPass":    {gopay.LangFa: "نام کاربری یا رمز عبور نادرست است", gopay.LangEn: "Invalid user ID or password"},
+	"erAAS_NotAllowedIp":           {gopay.LangFa: "آدرس IP پذیرنده مجاز نیست", gopay.LangEn: "Merchant IP address is not allowed"},
+	"erMts_ParamIsNull":            {gopay.LangFa: "پارامترهای ورودی ناقص است", gopay.LangEn: "Required parameter is missing"},
+	"erMts_InvalidAmount":          {gopay.LangFa: "مبلغ نامعتبر است", gopay.LangEn: "Invalid amount"},
+	"erMts_DuplicateReserveNum":    {gopay.LangFa: "شماره سفارش تکراری است", gopay.LangEn: "Duplicate reserve number"},
+	"erMts_InvalidToken":           {gopay.LangFa: "توکن نامعتبر است", gopay.LangEn: "Invalid token"},
+	"erMts_InvalidRefNum":          {gopay.LangFa: "شماره مرجع نامعتبر است", gopay.LangEn: "Invalid reference number"},
+	"erMts_TransAlreadyVerified":   {gopay.LangFa: "تراکنش قبلاً تأیید شده است", gopay.LangEn: "Transaction has already been verified"},
+	"erScm_InvalidAcceptor":        {gopay.LangFa: "پذیرنده نامعتبر است", gopay.LangEn: "Invalid acceptor"},
+	"erMts_UnknownError":           {gopay.LangFa: "خطای ناشناخته در سامانه فن‌آوا", gopay.LangEn: "Unknown Fanava error"},
+}
+
+// Schema کلیدهای پیکربندی درایور فن‌آوا
+var Schema = gopay.ConfigSchema{
+	{Key: "user_id", Type: gopay.FieldString, Required: true, Description: "Fanava WSContext user ID"},
+	{Key: "password", Type: gopay.FieldString, Required: true, Secret: true, Description: "Fanava WSContext password"},
+	{Key: "timeout", Type: gopay.FieldDuration, Default: "20s", Description: "HTTP client timeout"},
+}
+
 // آدرس‌های API بر اساس مستندات
 const (
+	driverName = "fanava_v1"
+
 	fanavaGenerateTokenEndpoint = "https://fcp.shaparak.ir/ref-payment/RestServices/mts/generateTokenWithNoSign/"
 	fanavaVerifyEndpoint        = "https://fcp.shaparak.ir/ref-payment/RestServices/mts/verifyMerchantTrans/"
+	fanavaInquiryEndpoint       = "https://fcp.shaparak.ir/ref-payment/RestServices/mts/inquiryMerchantToken/"
+	fanavaReverseEndpoint       = "https://fcp.shaparak.ir/ref-payment/RestServices/mts/reverseMerchantTrans/"
 	fanavaPaymentEndpoint       = "https://fep.shaparak.ir/ipgw//payment/"
 )
 
@@ -24,6 +57,7 @@ type FanavaDriver struct {
 	UserID     string
 	Password   string
 	HttpClient *http.Client
+	Retry      gopay.RetryPolicy
 }
 
 // wsContext ساختار مورد نیاز برای احراز هویت در تمام درخواست‌ها
@@ -63,31 +97,85 @@ type verifyResponse struct {
 	RefNum string `json:"RefNum"`
 }
 
-// NewFanava یک سازنده (InitializerFunc) برای ثبت در کلاینت
+// --- Reverse (Reverse Merchant Transaction) ---
+
+type reverseRequest struct {
+	WSContext wsContext `json:"WSContext"`
+	Token     string    `json:"Token"`
+	RefNum    string    `json:"RefNum"`
+}
+
+type reverseResponse struct {
+	Result string `json:"Result"` // "erSucceed" (موفق)
+	Amount int64  `json:"Amount"` // مبلغ برگشت‌خورده
+	RefNum string `json:"RefNum"`
+}
+
+// --- Inquiry (Inquiry Merchant Token) ---
+
+type inquiryRequest struct {
+	WSContext wsContext `json:"WSContext"`
+	Token     string    `json:"Token"`
+}
+
+type inquiryResponse struct {
+	Result string `json:"Result"` // "erSucceed" (موفق)
+	State  string `json:"State"`  // وضعیت تراکنش توکن
+	Amount int64  `json:"Amount"`
+	RefNum string `json:"RefNum"`
+}
+
+// NewFanava یک سازنده (InitializerFunc) برای ثبت در رجیستری gopay
 func NewFanava(config gopay.DriverConfig) (gopay.Driver, error) {
-	uid, ok := config["userID"]
+	uid, ok := config["user_id"]
 	if !ok {
-		return nil, fmt.Errorf("fanava: userID is not set in config")
+		return nil, fmt.Errorf("fanava: user_id is not set in config")
 	}
 	pass, ok := config["password"]
 	if !ok {
 		return nil, fmt.Errorf("fanava: password is not set in config")
 	}
+	timeout, err := config.Duration("timeout")
+	if err != nil {
+		return nil, fmt.Errorf("fanava: timeout is invalid: %w", err)
+	}
+	if timeout == 0 {
+		timeout = 20 * time.Second
+	}
 
 	return &FanavaDriver{
 		UserID:     uid,
 		Password:   pass,
-		HttpClient: &http.Client{Timeout: 20 * time.Second},
+		HttpClient: &http.Client{Timeout: timeout},
 	}, nil
 }
 
 // GetName نام درایور را برمی‌گرداند
 func (f *FanavaDriver) GetName() string {
-	return "fanava"
+	return driverName
+}
+
+// IsRetrySafe در فن‌آوا تأیید با توکن یکسان و استعلام idempotent هستند؛ تکرار generateTokenRequest توکن جدید می‌سازد
+func (f *FanavaDriver) IsRetrySafe(op gopay.Operation) bool {
+	return op == gopay.OpVerify || op == gopay.OpInquiry
+}
+
+func (f *FanavaDriver) SetRetryPolicy(policy gopay.RetryPolicy) {
+	f.Retry = policy
+}
+
+// AmountUnit فن‌آوا مبالغ را به ریال دریافت می‌کند
+func (f *FanavaDriver) AmountUnit() gopay.Unit {
+	return gopay.Rial
 }
 
 // Purchase متد پرداخت، توکن را دریافت و کاربر را برای هدایت آماده می‌کند
 func (f *FanavaDriver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*gopay.PaymentResponse, error) {
+	amount, err := req.Amount.In(f.AmountUnit())
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Kind: gopay.ErrInvalidAmount, Message: "Invalid amount", Err: err}
+	}
+
 	// ساخت بدنه درخواست به درگاه
 	apiReq := generateTokenRequest{
 		WSContext: wsContext{
@@ -96,7 +184,7 @@ func (f *FanavaDriver) Purchase(ctx context.Context, req *gopay.TransactionReque
 		},
 		TransType:   "EN_GOODS",
 		ReserveNum:  req.IdempotencyKey, // استفاده از IdempotencyKey به عنوان شماره فاکتور
-		Amount:      strconv.FormatInt(req.Amount, 10),
+		Amount:      strconv.FormatInt(amount, 10),
 		RedirectURL: req.CallbackURL,
 	}
 
@@ -110,6 +198,7 @@ func (f *FanavaDriver) Purchase(ctx context.Context, req *gopay.TransactionReque
 	var respData generateTokenResponse
 	if err := json.Unmarshal(respBody, &respData); err != nil {
 		return nil, &gopay.GatewayError{
+			Driver:  driverName,
 			Code:    -1,
 			Message: "Failed to parse Fanava response",
 			Err:     err,
@@ -118,14 +207,11 @@ func (f *FanavaDriver) Purchase(ctx context.Context, req *gopay.TransactionReque
 
 	// بررسی خطای دریافتی از API
 	if respData.Result != "erSucceed" {
-		return nil, &gopay.GatewayError{
-			Code:    0, // TODO: Map Fanava errors
-			Message: respData.Result,
-		}
+		return nil, fanavaError(respData.Result)
 	}
 
 	if respData.Token == "" {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Token was empty"}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Token was empty"}
 	}
 
 	// آماده‌سازی پاسخ برای هدایت کاربر
@@ -135,7 +221,7 @@ func (f *FanavaDriver) Purchase(ctx context.Context, req *gopay.TransactionReque
 		Message:        "Token generated successfully",
 		Authority:      respData.Token, // توکن را به عنوان شناسه تراکنش (Authority) ذخیره می‌کنیم
 		PaymentURL:     fanavaPaymentEndpoint,
-		RedirectMethod: "POST",
+		RedirectMethod: gopay.RedirectPOST,
 		RedirectParams: map[string]string{
 			"token":    respData.Token,
 			"language": "fa",
@@ -143,12 +229,17 @@ func (f *FanavaDriver) Purchase(ctx context.Context, req *gopay.TransactionReque
 	}, nil
 }
 
+// CallbackKey کلید تراکنش (token) را از callback فن‌آوا برمی‌گرداند
+func (f *FanavaDriver) CallbackKey(r *http.Request) string {
+	return r.FormValue("token")
+}
+
 // VerifyAndConfirm تراکنش را پس از بازگشت کاربر از درگاه، تأیید نهایی می‌کند
 func (f *FanavaDriver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher gopay.TransactionFetcher) (*gopay.VerificationResponse, error) {
 	// پارامترهای بازگشتی از درگاه (طبق مستندات)
 	// فرض می‌کنیم درگاه پارامترها را با متد POST برمی‌گرداند
 	if err := r.ParseForm(); err != nil {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Failed to parse callback form", Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Failed to parse callback form", Err: err}
 	}
 
 	token := r.FormValue("token")
@@ -165,15 +256,28 @@ func (f *FanavaDriver) VerifyAndConfirm(ctx context.Context, r *http.Request, fe
 	}
 
 	if token == "" || refNum == "" {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Invalid callback data (token or refNum is missing)"}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Invalid callback data (token or refNum is missing)"}
 	}
 
 	// دریافت اطلاعات تراکنش اصلی از دیتابیس (که در مرحله Purchase ذخیره کردیم)
 	originalTx, err := fetcher(ctx, token) // از توکن به عنوان Authority استفاده کردیم
 	if err != nil {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Transaction fetch failed", Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Transaction fetch failed", Err: err}
+	}
+	return f.verify(ctx, token, refNum, originalTx.Amount)
+}
+
+// Verify پرداخت توکن ref.Authority با شماره مرجع ref.ReferenceID را بدون callback تأیید
+// می‌کند (gopay.RefVerifier). مانند VerifyAndConfirm، مبلغ متفاوت با ref.Amount برگشت داده می‌شود.
+func (f *FanavaDriver) Verify(ctx context.Context, ref *gopay.TransactionRef) (*gopay.VerificationResponse, error) {
+	if ref.Authority == "" || ref.ReferenceID == "" {
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Kind: gopay.ErrInvalidTransaction, Message: "Token and RefNum are required for verify"}
 	}
+	return f.verify(ctx, ref.Authority, ref.ReferenceID, ref.Amount)
+}
 
+// verify تراکنش را با verifyMerchantTrans تأیید و مبلغ آن را با expected مقایسه می‌کند
+func (f *FanavaDriver) verify(ctx context.Context, token, refNum string, expected gopay.Money) (*gopay.VerificationResponse, error) {
 	// ساخت درخواست Verify
 	apiReq := verifyRequest{
 		WSContext: wsContext{
@@ -184,8 +288,13 @@ func (f *FanavaDriver) VerifyAndConfirm(ctx context.Context, r *http.Request, fe
 		RefNum: refNum,
 	}
 
-	// ارسال درخواست Verify
-	respBody, err := f.sendRequest(ctx, fanavaVerifyEndpoint, apiReq)
+	// ارسال درخواست Verify (تکرار verifyMerchantTrans برای توکن یکسان همان نتیجه را برمی‌گرداند)
+	var respBody []byte
+	err := gopay.Retry(ctx, f.Retry, f, gopay.OpVerify, func(ctx context.Context) error {
+		var err error
+		respBody, err = f.sendRequest(ctx, fanavaVerifyEndpoint, apiReq)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -193,27 +302,45 @@ func (f *FanavaDriver) VerifyAndConfirm(ctx context.Context, r *http.Request, fe
 	// پارس کردن پاسخ Verify
 	var respData verifyResponse
 	if err := json.Unmarshal(respBody, &respData); err != nil {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Failed to parse Fanava verify response", Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Failed to parse Fanava verify response", Err: err}
 	}
 
-	// بررسی خطای دریافتی از API
-	if respData.Result != "erSucceed" {
+	// تأیید تکراری یعنی وجه قبلاً برداشت شده است، نه شکست پرداخت
+	if respData.Result == "erMts_TransAlreadyVerified" {
 		return &gopay.VerificationResponse{
-			Status:       gopay.StatusFailed,
+			Status:       gopay.StatusAlreadyVerified,
 			ReferenceID:  refNum,
+			Message:      fanavaError(respData.Result).Message,
 			OriginalData: map[string]interface{}{"verify_response": respData},
 		}, nil
 	}
 
-	// بررسی تطابق مبلغ
-	if respData.Amount != originalTx.Amount {
-		// ! مهم: در این سناریو باید تراکنش را Reverse کرد
-		// TODO: Implement Refund (reverseMerchantTrans)
+	// بررسی خطای دریافتی از API
+	if respData.Result != "erSucceed" {
+		gatewayErr := fanavaError(respData.Result)
 		return &gopay.VerificationResponse{
-			Status:       gopay.StatusAmountMismatch,
+			Status:       gopay.StatusFailed,
 			ReferenceID:  refNum,
+			Message:      gatewayErr.Message,
+			FailedStage:  gopay.OpVerify,
 			OriginalData: map[string]interface{}{"verify_response": respData},
-		}, nil
+		}, gatewayErr
+	}
+
+	// بررسی تطابق مبلغ؛ وجه تراکنش تأییدشده با مبلغ متفاوت به کارت پرداخت‌کننده برگشت داده می‌شود
+	if !gopay.Rials(respData.Amount).Equal(expected) {
+		reversal, err := f.reverse(ctx, token, refNum)
+		return &gopay.VerificationResponse{
+			Status:      gopay.StatusAmountMismatch,
+			ReferenceID: refNum,
+			Message:     reversal.Message,
+			FailedStage: gopay.OpVerify,
+			Reversal:    reversal,
+			OriginalData: map[string]interface{}{
+				"verify_response": respData,
+				"expected_amount": expected,
+			},
+		}, err
 	}
 
 	// تراکنش موفق و تایید شده است
@@ -225,37 +352,229 @@ func (f *FanavaDriver) VerifyAndConfirm(ctx context.Context, r *http.Request, fe
 	}, nil
 }
 
+// Reverse تراکنش تأییدشده توکن ref.Authority با شماره مرجع ref.ReferenceID را با
+// reverseMerchantTrans برگشت می‌زند؛ وجه به کارت پرداخت‌کننده برمی‌گردد
+func (f *FanavaDriver) Reverse(ctx context.Context, ref *gopay.TransactionRef) (*gopay.VerificationResponse, error) {
+	if ref.Authority == "" || ref.ReferenceID == "" {
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Kind: gopay.ErrInvalidTransaction, Message: "Token and RefNum are required for reverse"}
+	}
+	reversal, err := f.reverse(ctx, ref.Authority, ref.ReferenceID)
+	if err != nil {
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed, ReferenceID: ref.ReferenceID, FailedStage: gopay.OpReverse, Reversal: reversal}, err
+	}
+	return &gopay.VerificationResponse{
+		Status:      gopay.StatusReversed,
+		ReferenceID: ref.ReferenceID,
+		Message:     reversal.Message,
+		Reversal:    reversal,
+	}, nil
+}
+
+// Refund بازپرداخت در فن‌آوا همان برگشت کامل تراکنش با reverseMerchantTrans است؛
+// req.Amount باید صفر یا برابر req.OriginalAmount باشد و بازپرداخت جزئی
+// ErrUnsupportedOperation برمی‌گرداند. req.Authority توکن پرداخت و req.ReferenceID شماره مرجع (RefNum) است.
+func (f *FanavaDriver) Refund(ctx context.Context, req *gopay.RefundRequest) (*gopay.RefundResponse, error) {
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = req.OriginalAmount
+	} else if !amount.Equal(req.OriginalAmount) {
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Err: gopay.ErrUnsupportedOperation, Message: "Fanava only refunds the full transaction amount"}
+	}
+	resp, err := f.Reverse(ctx, &gopay.TransactionRef{Authority: req.Authority, ReferenceID: req.ReferenceID})
+	if resp == nil {
+		return nil, err
+	}
+	now := time.Now()
+	refund := &gopay.RefundResponse{
+		IsSuccess:    resp.Status == gopay.StatusReversed,
+		RefundID:     req.ReferenceID,
+		Amount:       amount,
+		Method:       gopay.RefundInstant,
+		Status:       gopay.RefundFailed,
+		Message:      resp.Message,
+		RequestedAt:  now,
+		OriginalData: resp.OriginalData,
+	}
+	if refund.IsSuccess {
+		refund.Status = gopay.RefundCompleted
+		refund.CompletedAt = now
+	}
+	return refund, err
+}
+
+// reverse برگشت را انجام می‌دهد و نتیجه را (حتی در صورت خطا) برمی‌گرداند. برگشت تکرار
+// نمی‌شود، چون فن‌آوا برای تراکنش برگشت‌خورده کد موفق برنمی‌گرداند.
+func (f *FanavaDriver) reverse(ctx context.Context, token, refNum string) (*gopay.ReversalResult, error) {
+	apiReq := reverseRequest{
+		WSContext: wsContext{
+			UserID:   f.UserID,
+			Password: f.Password,
+		},
+		Token:  token,
+		RefNum: refNum,
+	}
+
+	respBody, err := f.sendRequest(ctx, fanavaReverseEndpoint, apiReq)
+	if err != nil {
+		return &gopay.ReversalResult{Message: "reverse request failed"}, err
+	}
+
+	var respData reverseResponse
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return &gopay.ReversalResult{Message: "reverse response is invalid"},
+			&gopay.GatewayError{Driver: driverName, Code: -1, Message: "Failed to parse Fanava reverse response", Err: err}
+	}
+
+	if respData.Result != "erSucceed" {
+		gatewayErr := fanavaError(respData.Result)
+		return &gopay.ReversalResult{Code: respData.Result, Message: gatewayErr.Message}, gatewayErr
+	}
+	message, _ := gopay.DefaultCatalog.CodeMessage(driverName, respData.Result, gopay.LangFa)
+	return &gopay.ReversalResult{Reversed: true, Code: respData.Result, Message: message}, nil
+}
+
+// Inquire وضعیت تراکنش توکن ref.Authority را با inquiryMerchantToken استعلام می‌کند
+func (f *FanavaDriver) Inquire(ctx context.Context, ref *gopay.TransactionRef) (*gopay.InquiryResponse, error) {
+	if ref.Authority == "" {
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Kind: gopay.ErrInvalidTransaction, Message: "Token is required for inquiry"}
+	}
+
+	apiReq := inquiryRequest{
+		WSContext: wsContext{
+			UserID:   f.UserID,
+			Password: f.Password,
+		},
+		Token: ref.Authority,
+	}
+
+	var respBody []byte
+	err := gopay.Retry(ctx, f.Retry, f, gopay.OpInquiry, func(ctx context.Context) error {
+		var err error
+		respBody, err = f.sendRequest(ctx, fanavaInquiryEndpoint, apiReq)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var respData inquiryResponse
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Failed to parse Fanava inquiry response", Err: err}
+	}
+
+	if respData.Result != "erSucceed" {
+		gatewayErr := fanavaError(respData.Result)
+		if !errors.Is(gatewayErr, gopay.ErrInvalidTransaction) {
+			return nil, gatewayErr
+		}
+		// توکن نامعتبر یا منقضی یعنی پرداختی با این توکن انجام نشده است
+		return &gopay.InquiryResponse{
+			Status:       gopay.StatusFailed,
+			Message:      gatewayErr.Message,
+			OriginalData: map[string]interface{}{"inquiry_response": respData},
+		}, nil
+	}
+
+	return &gopay.InquiryResponse{
+		Status:       inquiryStateToStatus(respData.State),
+		Amount:       gopay.Rials(respData.Amount),
+		ReferenceID:  respData.RefNum,
+		OriginalData: map[string]interface{}{"inquiry_response": respData},
+	}, nil
+}
+
+// inquiryStateToStatus وضعیت تراکنش در پاسخ استعلام فن‌آوا را به وضعیت gopay تبدیل می‌کند
+func inquiryStateToStatus(state string) gopay.VerificationStatus {
+	switch state {
+	case "OK":
+		return gopay.StatusSuccess
+	case "Verified", "Settled":
+		return gopay.StatusAlreadyVerified
+	case "Reversed":
+		return gopay.StatusReversed
+	case "CanceledByUser":
+		return gopay.StatusCancelled
+	case "", "New", "InProgress":
+		return gopay.StatusPending
+	default:
+		return gopay.StatusFailed
+	}
+}
+
 // sendRequest یک متد کمکی برای ارسال درخواست‌های JSON
 func (f *FanavaDriver) sendRequest(ctx context.Context, url string, reqBody interface{}) ([]byte, error) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Failed to marshal request", Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Failed to marshal request", Err: err}
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Failed to create HTTP request", Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Message: "Failed to create HTTP request", Err: err}
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 
 	resp, err := f.HttpClient.Do(req)
 	if err != nil {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Failed to send request", Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Kind: gopay.ErrGatewayUnavailable, Message: "Failed to send request", Err: err}
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, &gopay.GatewayError{Code: -1, Message: "Failed to read response body", Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Code: -1, Kind: gopay.ErrGatewayUnavailable, Message: "Failed to read response body", Err: err}
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, &gopay.GatewayError{
+		gatewayErr := &gopay.GatewayError{
+			Driver:  driverName,
 			Code:    resp.StatusCode,
 			Message: fmt.Sprintf("HTTP Error %d: %s", resp.StatusCode, string(respBody)),
 		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			gatewayErr.Kind = gopay.ErrGatewayUnavailable
+		}
+		return nil, gatewayErr
 	}
 
 	return respBody, nil
 }
+
+// fanavaError کد متنی Result فن‌آوا را به GatewayError با دسته‌بندی نرمال‌شده تبدیل می‌کند
+func fanavaError(result string) *gopay.GatewayError {
+	message := result
+	if text, ok := gopay.DefaultCatalog.CodeMessage(driverName, result, gopay.LangFa); ok {
+		message = text
+	}
+	return &gopay.GatewayError{
+		Driver:  driverName,
+		Code:    -1,
+		RawCode: result,
+		Kind:    fanavaResultToKind(result),
+		Message: message,
+	}
+}
+
+// fanavaResultToKind مقدار Result مستندشده فن‌آوا را به دسته‌بندی نرمال‌شده تبدیل می‌کند؛
+// مقادیر ناشناخته دسته‌بندی ندارند
+func fanavaResultToKind(result string) error {
+	switch result {
+	case "erAAS_NotAllowedIp":
+		return gopay.ErrIPNotWhitelisted
+	case "erAAS_UseridOrPassIsRequired", "erAAS_InvalidUseridOrPass", "erScm_InvalidAcceptor":
+		return gopay.ErrAuthFailed
+	case "erMts_DuplicateReserveNum":
+		return gopay.ErrDuplicateOrder
+	case "erMts_InvalidAmount":
+		return gopay.ErrInvalidAmount
+	case "erMts_TransAlreadyVerified":
+		return gopay.ErrAlreadyVerified
+	case "erMts_InvalidToken", "erMts_InvalidRefNum":
+		return gopay.ErrInvalidTransaction
+	case "erMts_UnknownError":
+		return gopay.ErrGatewayUnavailable
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,212 @@
+package fanava_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arminmiraftab/GoPay"
+)
+
+// fakeBank بدنه JSON پاسخ هر سرویس (مثل verifyMerchantTrans) را از responses برمی‌گرداند
+type fakeBank struct {
+	mu        sync.Mutex
+	responses map[string]string
+	calls     []string
+}
+
+func (b *fakeBank) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service := path.Base(r.URL.Path)
+	b.mu.Lock()
+	b.calls = append(b.calls, service)
+	body, ok := b.responses[service]
+	b.mu.Unlock()
+	if !ok {
+		http.Error(w, "unexpected service "+service, http.StatusBadRequest)
+		return
+	}
+	fmt.Fprint(w, body)
+}
+
+func (b *fakeBank) called(service string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.calls {
+		if c == service {
+			return true
+		}
+	}
+	return false
+}
+
+// redirect همه درخواست‌ها را به سرور تست می‌فرستد
+type redirect struct{ target *url.URL }
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestDriver(t *testing.T, responses map[string]string) (*FanavaDriver, *fakeBank) {
+	t.Helper()
+	bank := &fakeBank{responses: responses}
+	srv := httptest.NewServer(bank)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	return &FanavaDriver{
+		UserID:     "user",
+		Password:   "pass",
+		HttpClient: &http.Client{Transport: redirect{target}},
+		Retry:      gopay.RetryPolicy{MaxAttempts: 1},
+	}, bank
+}
+
+func callback() *http.Request {
+	form := url.Values{"token": {"T1"}, "RefNum": {"R1"}, "State": {"OK"}}
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func fetcher(amount gopay.Money) gopay.TransactionFetcher {
+	return func(context.Context, string) (*gopay.OriginalTransaction, error) {
+		return &gopay.OriginalTransaction{Amount: amount}, nil
+	}
+}
+
+func TestVerifyAndConfirmReturnsGatewayError(t *testing.T) {
+	d, _ := newTestDriver(t, map[string]string{
+		"verifyMerchantTrans": `{"Result": "erMts_InvalidToken"}`,
+	})
+
+	resp, err := d.VerifyAndConfirm(context.Background(), callback(), fetcher(gopay.Rials(10000)))
+	if !errors.Is(err, gopay.ErrInvalidTransaction) {
+		t.Fatalf("err = %v, want ErrInvalidTransaction", err)
+	}
+	var gatewayErr *gopay.GatewayError
+	if !errors.As(err, &gatewayErr) || gatewayErr.RawCode != "erMts_InvalidToken" {
+		t.Fatalf("err = %#v, want the raw Fanava result", err)
+	}
+	if resp == nil || resp.Status != gopay.StatusFailed || resp.FailedStage != gopay.OpVerify {
+		t.Fatalf("got %+v", resp)
+	}
+	if gatewayErr.Driver != d.GetName() {
+		t.Fatalf("error driver %q, GetName %q", gatewayErr.Driver, d.GetName())
+	}
+	if _, err := gopay.Schema(d.GetName()); err != nil {
+		t.Fatalf("GetName does not match the registered type: %v", err)
+	}
+}
+
+func TestVerifyAndConfirmReversesAmountMismatch(t *testing.T) {
+	d, bank := newTestDriver(t, map[string]string{
+		"verifyMerchantTrans":  `{"Result": "erSucceed", "Amount": 9000, "RefNum": "R1"}`,
+		"reverseMerchantTrans": `{"Result": "erSucceed", "Amount": 9000, "RefNum": "R1"}`,
+	})
+
+	resp, err := d.VerifyAndConfirm(context.Background(), callback(), fetcher(gopay.Rials(10000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != gopay.StatusAmountMismatch || !resp.Reversal.Reversed || !bank.called("reverseMerchantTrans") {
+		t.Fatalf("got %+v", resp)
+	}
+}
+
+func TestVerifyAndConfirmReportsFailedReversal(t *testing.T) {
+	d, bank := newTestDriver(t, map[string]string{
+		"verifyMerchantTrans":  `{"Result": "erSucceed", "Amount": 9000, "RefNum": "R1"}`,
+		"reverseMerchantTrans": `{"Result": "erMts_UnknownError"}`,
+	})
+
+	resp, err := d.VerifyAndConfirm(context.Background(), callback(), fetcher(gopay.Rials(10000)))
+	if !errors.Is(err, gopay.ErrGatewayUnavailable) {
+		t.Fatalf("err = %v, want the reversal error", err)
+	}
+	// وجه برداشت شده و برگشت نخورده است؛ Client تراکنش را reverse_pending ثبت می‌کند
+	if resp.Status != gopay.StatusAmountMismatch || resp.Reversal == nil || resp.Reversal.Reversed || resp.ReferenceID != "R1" {
+		t.Fatalf("got %+v", resp)
+	}
+
+	// Reconciler برگشت را با Reverse تکرار می‌کند
+	bank.mu.Lock()
+	bank.responses["reverseMerchantTrans"] = `{"Result": "erSucceed", "Amount": 9000, "RefNum": "R1"}`
+	bank.mu.Unlock()
+	reversed, err := d.Reverse(context.Background(), &gopay.TransactionRef{Authority: "T1", ReferenceID: resp.ReferenceID})
+	if err != nil || reversed.Status != gopay.StatusReversed {
+		t.Fatalf("retried reverse = %+v, %v", reversed, err)
+	}
+}
+
+func TestVerifyAndConfirmReportsAlreadyVerified(t *testing.T) {
+	d, _ := newTestDriver(t, map[string]string{
+		"verifyMerchantTrans": `{"Result": "erMts_TransAlreadyVerified"}`,
+	})
+
+	resp, err := d.VerifyAndConfirm(context.Background(), callback(), fetcher(gopay.Rials(10000)))
+	if err != nil || resp.Status != gopay.StatusAlreadyVerified || resp.ReferenceID != "R1" {
+		t.Fatalf("got %+v, %v; want StatusAlreadyVerified", resp, err)
+	}
+}
+
+func TestFanavaResultToKind(t *testing.T) {
+	tests := map[string]error{
+		"erAAS_NotAllowedIp":         gopay.ErrIPNotWhitelisted,
+		"erAAS_InvalidUseridOrPass":  gopay.ErrAuthFailed,
+		"erScm_InvalidAcceptor":      gopay.ErrAuthFailed,
+		"erMts_DuplicateReserveNum":  gopay.ErrDuplicateOrder,
+		"erMts_InvalidAmount":        gopay.ErrInvalidAmount,
+		"erMts_TransAlreadyVerified": gopay.ErrAlreadyVerified,
+		"erMts_InvalidRefNum":        gopay.ErrInvalidTransaction,
+		"erMts_UnknownError":         gopay.ErrGatewayUnavailable,
+		// نام‌هایی که فقط شبیه کدهای مستند هستند نباید دسته‌بندی بگیرند
+		"erMts_ParamIsNull":       nil,
+		"erMts_TransNotFoundIpxx": nil,
+	}
+	for result, want := range tests {
+		if got := fanavaResultToKind(result); got != want {
+			t.Errorf("fanavaResultToKind(%q) = %v, want %v", result, got, want)
+		}
+	}
+}
+
+func TestVerifyByRef(t *testing.T) {
+	d, _ := newTestDriver(t, map[string]string{
+		"verifyMerchantTrans": `{"Result": "erSucceed", "Amount": 10000, "RefNum": "R1"}`,
+	})
+	resp, err := d.Verify(context.Background(), &gopay.TransactionRef{Authority: "T1", ReferenceID: "R1", Amount: gopay.Rials(10000)})
+	if err != nil || resp.Status != gopay.StatusSuccess {
+		t.Fatalf("got %+v, %v", resp, err)
+	}
+	if _, err := d.Verify(context.Background(), &gopay.TransactionRef{Authority: "T1"}); !errors.Is(err, gopay.ErrInvalidTransaction) {
+		t.Fatalf("missing RefNum: err = %v", err)
+	}
+}
+
+func TestRefundRejectsPartialAmount(t *testing.T) {
+	d, bank := newTestDriver(t, map[string]string{
+		"reverseMerchantTrans": `{"Result": "erSucceed", "Amount": 10000, "RefNum": "R1"}`,
+	})
+	req := &gopay.RefundRequest{Authority: "T1", ReferenceID: "R1", Amount: gopay.Rials(4000), OriginalAmount: gopay.Rials(10000)}
+	if _, err := d.Refund(context.Background(), req); !errors.Is(err, gopay.ErrUnsupportedOperation) {
+		t.Fatalf("partial refund: err = %v, want ErrUnsupportedOperation", err)
+	}
+	if bank.called("reverseMerchantTrans") {
+		t.Fatal("partial refund reversed the whole transaction")
+	}
+
+	for _, amount := range []gopay.Money{{}, gopay.Tomans(1000)} {
+		req.Amount = amount
+		resp, err := d.Refund(context.Background(), req)
+		if err != nil || resp.Status != gopay.RefundCompleted || !resp.Amount.Equal(gopay.Rials(10000)) {
+			t.Fatalf("full refund with amount %s: resp=%+v err=%v", amount, resp, err)
+		}
+	}
+}
@@ -9,26 +9,60 @@ import (
 	"github.com/arminmiraftab/GoPay"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+const driverName = "parsian_v1"
+
+func init() {
+	gopay.Register(driverName, New, Schema)
+	gopay.RegisterMessages(driverName, messages)
+}
+
+// Schema کلیدهای پیکربندی درایور پارسیان
+var Schema = gopay.ConfigSchema{
+	{Key: "login_account", Type: gopay.FieldString, Required: true, Secret: true, Description: "Parsian PIN (LoginAccount)"},
+	{Key: "timeout", Type: gopay.FieldDuration, Default: "20s", Description: "HTTP client timeout"},
+}
+
 // =======================
 // 📦 ساختار درایور پارسیان
 // =======================
 
 type Driver struct {
 	LoginAccount string
+	Client       *http.Client
+	Retry        gopay.RetryPolicy
 }
 
+var _ gopay.Driver = (*Driver)(nil)
+var _ gopay.RedirectPayer = (*Driver)(nil)
+var _ gopay.UnitDeclarer = (*Driver)(nil)
+var _ gopay.CallbackIdentifier = (*Driver)(nil)
+var _ gopay.NumericOrderIDDriver = (*Driver)(nil)
+var _ gopay.Inquirer = (*Driver)(nil)
+var _ gopay.RefVerifier = (*Driver)(nil)
+var _ gopay.RetrySafety = (*Driver)(nil)
+var _ gopay.RetryConfigurable = (*Driver)(nil)
+
 // =======================
 // 🏗️ تابع سازنده درایور
 // =======================
 
-func New(config gopay.DriverConfig) (gopay.RedirectPayer, error) {
+func New(config gopay.DriverConfig) (gopay.Driver, error) {
 	login := config["login_account"]
 	if login == "" {
 		return nil, errors.New("missing login_account in config")
 	}
-	return &Driver{LoginAccount: login}, nil
+	timeout, err := config.Duration("timeout")
+	if err != nil {
+		return nil, fmt.Errorf("parsian_v1 config 'timeout' is invalid: %w", err)
+	}
+	if timeout == 0 {
+		timeout = 20 * time.Second
+	}
+	return &Driver{LoginAccount: login, Client: &http.Client{Timeout: timeout}}, nil
 }
 
 // =======================
@@ -36,6 +70,15 @@ func New(config gopay.DriverConfig) (gopay.RedirectPayer, error) {
 // =======================
 
 func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*gopay.PaymentResponse, error) {
+	amount, err := req.Amount.In(d.AmountUnit())
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidAmount, Err: err, Message: "invalid amount"}
+	}
+	orderId, err := req.NumericOrderID()
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "invalid OrderId"}
+	}
+
 	soapBody := fmt.Sprintf(`
 	<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
 		xmlns:xsd="http://www.w3.org/2001/XMLSchema"
@@ -45,29 +88,22 @@ func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*
 				<requestData>
 					<LoginAccount>%s</LoginAccount>
 					<Amount>%d</Amount>
-					<OrderId>%s</OrderId>
+					<OrderId>%d</OrderId>
 					<CallBackUrl>%s</CallBackUrl>
 					<AdditionalData></AdditionalData>
 				</requestData>
 			</SalePaymentRequest>
 		</soap:Body>
-	</soap:Envelope>`, d.LoginAccount, req.Amount, req.IdempotencyKey, req.CallbackURL)
+	</soap:Envelope>`, d.LoginAccount, amount, orderId, req.CallbackURL)
 
-	httpReq, _ := http.NewRequestWithContext(ctx, "POST",
+	// SalePaymentRequest تکرار نمی‌شود؛ هر فراخوانی توکن جدیدی می‌سازد
+	body, err := d.call(ctx,
 		"https://pec.shaparak.ir/NewIPGServices/Sale/SaleService.asmx",
-		bytes.NewBuffer([]byte(soapBody)))
-
-	httpReq.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	httpReq.Header.Set("SOAPAction",
-		"https://pec.Shaparak.ir/NewIPGServices/Sale/SaleService/SalePaymentRequest")
-
-	resp, err := http.DefaultClient.Do(httpReq)
+		"https://pec.Shaparak.ir/NewIPGServices/Sale/SaleService/SalePaymentRequest",
+		soapBody)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 
 	// Parse XML Response
 	type SalePaymentResult struct {
@@ -86,22 +122,24 @@ func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*
 
 	var parsed SalePaymentResponse
 	if err := xml.Unmarshal(body, &parsed); err != nil {
-		return nil, fmt.Errorf("xml parse error: %v", err)
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "xml parse error"}
 	}
 
 	result := parsed.Body.Response.Result
 	if result.Status != 0 {
-		return nil, fmt.Errorf("parsian error: %s", parsianStatusToMessage(result.Status))
+		return nil, parsianError(result.Status)
 	}
 
 	token := result.Token
 	paymentURL := fmt.Sprintf("https://pec.shaparak.ir/NewIPG/?Token=%d", token)
 
 	return &gopay.PaymentResponse{
-		Success:    true,
-		Message:    result.Message,
-		Authority:  fmt.Sprintf("%d", token),
-		PaymentURL: paymentURL,
+		Success:        true,
+		Message:        result.Message,
+		Authority:      fmt.Sprintf("%d", token),
+		OrderID:        fmt.Sprintf("%d", orderId),
+		PaymentURL:     paymentURL,
+		RedirectMethod: gopay.RedirectGET,
 	}, nil
 }
 
@@ -109,12 +147,37 @@ func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*
 // 🔍 مرحله ۲: تأیید و نهایی‌سازی پرداخت (ConfirmPayment)
 // =======================
 
+// CallbackKey کلید تراکنش (Token) را از callback پارسیان برمی‌گرداند
+func (d *Driver) CallbackKey(r *http.Request) string {
+	return r.FormValue("Token")
+}
+
 func (d *Driver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher gopay.TransactionFetcher) (*gopay.VerificationResponse, error) {
 	token := r.FormValue("Token")
 	if token == "" {
-		return nil, errors.New("missing Token in callback request")
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Message: "missing Token in callback request"}
+	}
+	// پارسیان نتیجه پرداخت را در فیلد status callback می‌فرستد؛ پرداخت ناموفق یا لغوشده تأیید نمی‌شود
+	if statusStr := r.FormValue("status"); statusStr != "" && statusStr != "0" {
+		status, err := strconv.Atoi(statusStr)
+		if err != nil {
+			return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "invalid status in callback request"}
+		}
+		return failedResponse(status)
 	}
+	return d.confirm(ctx, token)
+}
 
+// Verify پرداخت Token ref.Authority را بدون callback با ConfirmPayment تأیید می‌کند (gopay.RefVerifier)
+func (d *Driver) Verify(ctx context.Context, ref *gopay.TransactionRef) (*gopay.VerificationResponse, error) {
+	if ref.Authority == "" {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Message: "Token is required for verify"}
+	}
+	return d.confirm(ctx, ref.Authority)
+}
+
+// confirm درخواست ConfirmPayment را برای token می‌فرستد
+func (d *Driver) confirm(ctx context.Context, token string) (*gopay.VerificationResponse, error) {
 	confirmBody := fmt.Sprintf(`
 	<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
 	xmlns:xsd="http://www.w3.org/2001/XMLSchema"
@@ -129,21 +192,19 @@ func (d *Driver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher
 	  </soap:Body>
 	</soap:Envelope>`, d.LoginAccount, token)
 
-	reqConfirm, _ := http.NewRequestWithContext(ctx, "POST",
-		"https://pec.shaparak.ir/NewIPGServices/Confirm/ConfirmService.asmx",
-		bytes.NewBuffer([]byte(confirmBody)))
-
-	reqConfirm.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	reqConfirm.Header.Set("SOAPAction",
-		"https://pec.Shaparak.ir/NewIPGServices/Confirm/ConfirmService/ConfirmPayment")
-
-	res, err := http.DefaultClient.Do(reqConfirm)
+	// ConfirmPayment برای Token یکسان همان نتیجه را برمی‌گرداند، پس خطای شبکه دوباره ارسال می‌شود
+	var body []byte
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpVerify, func(ctx context.Context) error {
+		var err error
+		body, err = d.call(ctx,
+			"https://pec.shaparak.ir/NewIPGServices/Confirm/ConfirmService.asmx",
+			"https://pec.Shaparak.ir/NewIPGServices/Confirm/ConfirmService/ConfirmPayment",
+			confirmBody)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	body, _ := io.ReadAll(res.Body)
 
 	// Parse ConfirmPaymentResponse
 	type ConfirmResult struct {
@@ -163,15 +224,12 @@ func (d *Driver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher
 
 	var confirm ConfirmEnvelope
 	if err := xml.Unmarshal(body, &confirm); err != nil {
-		return nil, fmt.Errorf("xml parse error: %v", err)
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "xml parse error"}
 	}
 
 	result := confirm.Body.Response.Result
 	if result.Status != 0 {
-		return &gopay.VerificationResponse{
-			Status:  gopay.StatusFailed,
-			Message: parsianStatusToMessage(result.Status),
-		}, nil
+		return failedResponse(result.Status)
 	}
 
 	return &gopay.VerificationResponse{
@@ -181,48 +239,220 @@ func (d *Driver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher
 	}, nil
 }
 
+// failedResponse پاسخ پرداخت ناموفق با کد status را می‌سازد؛ لغو توسط کاربر StatusCancelled است
+func failedResponse(status int) (*gopay.VerificationResponse, error) {
+	err := parsianError(status)
+	resp := &gopay.VerificationResponse{Status: gopay.StatusFailed, Message: err.Message}
+	if errors.Is(err, gopay.ErrUserCancelled) {
+		resp.Status = gopay.StatusCancelled
+	}
+	return resp, err
+}
+
+// =======================
+// 🔎 استعلام وضعیت تراکنش (GetTransactionStatus)
+// =======================
+
+// Inquire وضعیت تراکنش Token ref.Authority را از سرویس استعلام پارسیان می‌گیرد
+func (d *Driver) Inquire(ctx context.Context, ref *gopay.TransactionRef) (*gopay.InquiryResponse, error) {
+	if ref.Authority == "" {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Message: "Token is required for inquiry"}
+	}
+
+	inquiryBody := fmt.Sprintf(`
+	<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+	xmlns:xsd="http://www.w3.org/2001/XMLSchema"
+	xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	  <soap:Body>
+		<GetTransactionStatus xmlns="https://pec.Shaparak.ir/NewIPGServices/Inquiry/InquiryService">
+		  <requestData>
+			<LoginAccount>%s</LoginAccount>
+			<Token>%s</Token>
+		  </requestData>
+		</GetTransactionStatus>
+	  </soap:Body>
+	</soap:Envelope>`, d.LoginAccount, ref.Authority)
+
+	var body []byte
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpInquiry, func(ctx context.Context) error {
+		var err error
+		body, err = d.call(ctx,
+			"https://pec.shaparak.ir/NewIPGServices/Inquiry/InquiryService.asmx",
+			"https://pec.Shaparak.ir/NewIPGServices/Inquiry/InquiryService/GetTransactionStatus",
+			inquiryBody)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type InquiryResult struct {
+		Status  int    `xml:"Status"`
+		Amount  int64  `xml:"Amount"`
+		RRN     int64  `xml:"RRN"`
+		Message string `xml:"Message"`
+	}
+	type InquiryEnvelope struct {
+		XMLName xml.Name `xml:"Envelope"`
+		Body    struct {
+			Response struct {
+				Result InquiryResult `xml:"GetTransactionStatusResult"`
+			} `xml:"GetTransactionStatusResponse"`
+		} `xml:"Body"`
+	}
+
+	var inquiry InquiryEnvelope
+	if err := xml.Unmarshal(body, &inquiry); err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "xml parse error"}
+	}
+
+	result := inquiry.Body.Response.Result
+	if errors.Is(parsianStatusToKind(result.Status), gopay.ErrGatewayUnavailable) {
+		return nil, parsianError(result.Status)
+	}
+
+	resp := &gopay.InquiryResponse{
+		Status:  inquiryStatusToStatus(result.Status),
+		Amount:  gopay.Rials(result.Amount),
+		Message: parsianStatusToMessage(result.Status),
+		OriginalData: map[string]interface{}{
+			"Token":  ref.Authority,
+			"Status": result.Status,
+		},
+	}
+	if result.RRN > 0 {
+		resp.ReferenceID = fmt.Sprintf("%d", result.RRN)
+	}
+	return resp, nil
+}
+
+// inquiryStatusToStatus کد وضعیت استعلام پارسیان را به وضعیت gopay تبدیل می‌کند
+func inquiryStatusToStatus(status int) gopay.VerificationStatus {
+	switch status {
+	case 0:
+		return gopay.StatusSuccess
+	case -138:
+		return gopay.StatusCancelled
+	case -1551:
+		return gopay.StatusReversed
+	default:
+		return gopay.StatusFailed
+	}
+}
+
 // =======================
 // 📛 نام درایور برای لاگ یا فکتوری
 // =======================
 
+// IsRetrySafe تأیید و استعلام پارسیان idempotent هستند؛ SalePaymentRequest هر بار توکن جدید می‌سازد
+func (d *Driver) IsRetrySafe(op gopay.Operation) bool {
+	return op == gopay.OpVerify || op == gopay.OpInquiry
+}
+
+func (d *Driver) SetRetryPolicy(policy gopay.RetryPolicy) {
+	d.Retry = policy
+}
+
+// call درخواست SOAP را به endpoint می‌فرستد و بدنه پاسخ را برمی‌گرداند؛ خطای انتقال
+// و پاسخ 5xx با دسته ErrGatewayUnavailable برچسب می‌خورند
+func (d *Driver) call(ctx context.Context, endpoint, action, soapBody string) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBufferString(soapBody))
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err}
+	}
+	httpReq.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	httpReq.Header.Set("SOAPAction", action)
+
+	res, err := d.Client.Do(httpReq)
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: "failed to call " + action}
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err, Message: "failed to read response"}
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Message: fmt.Sprintf("unexpected http status %d", res.StatusCode)}
+	}
+	return body, nil
+}
+
 func (d *Driver) GetName() string {
-	return "parsian_v1"
+	return driverName
+}
+
+// RequiresNumericOrderID پارسیان شماره سفارش عددی و یکتا به ازای پذیرنده می‌خواهد
+func (d *Driver) RequiresNumericOrderID() bool {
+	return true
+}
+
+// AmountUnit پارسیان مبالغ را به ریال دریافت می‌کند
+func (d *Driver) AmountUnit() gopay.Unit {
+	return gopay.Rial
 }
 
 // =======================
-// ⚙️ نگاشت کدهای خطای پارسیان به پیام‌های فارسی
+// ⚙️ نگاشت کدهای خطای پارسیان به دسته‌بندی نرمال‌شده و پیام‌های فارسی
 // =======================
 
-func parsianStatusToMessage(status int) string {
+func parsianError(status int) *gopay.GatewayError {
+	return &gopay.GatewayError{
+		Driver:  driverName,
+		Code:    status,
+		Kind:    parsianStatusToKind(status),
+		Message: parsianStatusToMessage(status),
+	}
+}
+
+func parsianStatusToKind(status int) error {
 	switch status {
-	case 0:
-		return "عملیات با موفقیت انجام شد"
-	case -1:
-		return "خطای داخلی سرور بانک پارسیان"
-	case -2:
-		return "تراکنش تکراری یا نامعتبر"
-	case -3:
-		return "پاسخ نامعتبر از سامانه مرکزی"
-	case -100:
-		return "پذیرنده غیرفعال است"
-	case -101:
-		return "پذیرنده احراز هویت نشد (LoginAccount یا IP نادرست است)"
-	case -102:
-		return "اطلاعات درخواست ناقص یا نادرست است"
+	case -1, -3:
+		return gopay.ErrGatewayUnavailable
+	case -2, -112:
+		return gopay.ErrDuplicateOrder
+	case -100, -101:
+		return gopay.ErrAuthFailed
 	case -111:
-		return "مبلغ تراکنش بیش از سقف مجاز پذیرنده است"
-	case -112:
-		return "شماره سفارش تکراری است"
+		return gopay.ErrInvalidAmount
 	case -127:
-		return "آدرس IP شما در لیست سفید بانک نیست"
+		return gopay.ErrIPNotWhitelisted
 	case -138:
-		return "پرداخت توسط کاربر لغو شد"
+		return gopay.ErrUserCancelled
 	case -1551:
-		return "برگشت تراکنش قبلاً انجام شده است"
+		return gopay.ErrInvalidTransaction
+	case 51:
+		return gopay.ErrInsufficientFunds
+	case 54, 55, 56:
+		return gopay.ErrInvalidCard
 	default:
-		if status > 0 {
-			return fmt.Sprintf("کد خطای شاپرک: %d — لطفاً وضعیت تراکنش را از شاپرک بررسی کنید", status)
-		}
-		return fmt.Sprintf("خطای ناشناخته با کد: %d", status)
+		return nil
+	}
+}
+
+// messages پیام‌های دوزبانه کدهای پاسخ پارسیان که در init() در کاتالوگ gopay ثبت می‌شوند
+var messages = map[string]gopay.Messages{
+	"0":     {gopay.LangFa: "عملیات با موفقیت انجام شد", gopay.LangEn: "Operation completed successfully"},
+	"-1":    {gopay.LangFa: "خطای داخلی سرور بانک پارسیان", gopay.LangEn: "Parsian internal server error"},
+	"-2":    {gopay.LangFa: "تراکنش تکراری یا نامعتبر", gopay.LangEn: "Duplicate or invalid transaction"},
+	"-3":    {gopay.LangFa: "پاسخ نامعتبر از سامانه مرکزی", gopay.LangEn: "Invalid response from the central system"},
+	"-100":  {gopay.LangFa: "پذیرنده غیرفعال است", gopay.LangEn: "Merchant is inactive"},
+	"-101":  {gopay.LangFa: "پذیرنده احراز هویت نشد (LoginAccount یا IP نادرست است)", gopay.LangEn: "Merchant authentication failed (wrong LoginAccount or IP)"},
+	"-102":  {gopay.LangFa: "اطلاعات درخواست ناقص یا نادرست است", gopay.LangEn: "Request data is incomplete or invalid"},
+	"-111":  {gopay.LangFa: "مبلغ تراکنش بیش از سقف مجاز پذیرنده است", gopay.LangEn: "Amount exceeds the merchant limit"},
+	"-112":  {gopay.LangFa: "شماره سفارش تکراری است", gopay.LangEn: "Duplicate order ID"},
+	"-127":  {gopay.LangFa: "آدرس IP شما در لیست سفید بانک نیست", gopay.LangEn: "Your IP address is not whitelisted by the bank"},
+	"-138":  {gopay.LangFa: "پرداخت توسط کاربر لغو شد", gopay.LangEn: "Payment was cancelled by the user"},
+	"-1551": {gopay.LangFa: "برگشت تراکنش قبلاً انجام شده است", gopay.LangEn: "Transaction has already been reversed"},
+}
+
+func parsianStatusToMessage(status int) string {
+	if text, ok := gopay.DefaultCatalog.CodeMessage(driverName, strconv.Itoa(status), gopay.LangFa); ok {
+		return text
+	}
+	if status > 0 {
+		return fmt.Sprintf("کد خطای شاپرک: %d — لطفاً وضعیت تراکنش را از شاپرک بررسی کنید", status)
 	}
+	return fmt.Sprintf("خطای ناشناخته با کد: %d", status)
 }
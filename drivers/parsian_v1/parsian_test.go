@@ -0,0 +1,130 @@
+package parsian_v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arminmiraftab/GoPay"
+)
+
+// fakeBank برای هر عملیات SOAP ابتدا failures بار خطای 503 و سپس status را برمی‌گرداند
+type fakeBank struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	calls    map[string]int
+}
+
+func (b *fakeBank) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := path.Base(r.Header.Get("SOAPAction"))
+	b.mu.Lock()
+	b.calls[action]++
+	fail := b.calls[action] <= b.failures
+	b.mu.Unlock()
+	if fail {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, `<Envelope><Body><%[1]sResponse><%[1]sResult><Status>%[2]d</Status><Token>900</Token><RRN>777</RRN></%[1]sResult></%[1]sResponse></Body></Envelope>`, action, b.status)
+}
+
+func (b *fakeBank) count(action string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls[action]
+}
+
+// redirect همه درخواست‌ها را به سرور تست می‌فرستد
+type redirect struct{ target *url.URL }
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestDriver(t *testing.T, failures int) (*Driver, *fakeBank) {
+	t.Helper()
+	bank := &fakeBank{failures: failures, calls: make(map[string]int)}
+	srv := httptest.NewServer(bank)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	d := &Driver{LoginAccount: "pin", Client: &http.Client{Transport: redirect{target}}}
+	d.SetRetryPolicy(gopay.RetryPolicy{MaxAttempts: 3})
+	return d, bank
+}
+
+func TestConfirmAndInquiryAreRetried(t *testing.T) {
+	ctx := context.Background()
+	d, bank := newTestDriver(t, 2)
+
+	form := url.Values{"Token": {"900"}}
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := d.VerifyAndConfirm(ctx, r, nil)
+	if err != nil {
+		t.Fatalf("VerifyAndConfirm: %v", err)
+	}
+	if resp.Status != gopay.StatusSuccess || resp.ReferenceID != "777" {
+		t.Fatalf("got %+v", resp)
+	}
+	if n := bank.count("ConfirmPayment"); n != 3 {
+		t.Fatalf("ConfirmPayment called %d times, want 3", n)
+	}
+
+	if _, err := d.Inquire(ctx, &gopay.TransactionRef{Authority: "900"}); err != nil {
+		t.Fatalf("Inquire: %v", err)
+	}
+	if n := bank.count("GetTransactionStatus"); n != 3 {
+		t.Fatalf("GetTransactionStatus called %d times, want 3", n)
+	}
+}
+
+func TestSaleIsNotRetried(t *testing.T) {
+	d, bank := newTestDriver(t, 1)
+
+	_, err := d.Purchase(context.Background(), &gopay.TransactionRequest{Amount: gopay.Rials(10000), OrderID: 1001})
+	if !errors.Is(err, gopay.ErrGatewayUnavailable) {
+		t.Fatalf("err = %v, want ErrGatewayUnavailable", err)
+	}
+	if n := bank.count("SalePaymentRequest"); n != 1 {
+		t.Fatalf("SalePaymentRequest called %d times, want 1", n)
+	}
+}
+
+func TestCallbackHandlerReportsCancelledPayment(t *testing.T) {
+	c, err := gopay.NewClient(&gopay.Config{Drivers: map[string]gopay.DriverConfig{
+		"parsian": {gopay.DriverTypeKey: driverName, "login_account": "pin"},
+	}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	var cancelled *gopay.CallbackResult
+	h := gopay.NewCallbackHandler(c, nil, gopay.CallbackHooks{
+		OnCancelled: func(w http.ResponseWriter, r *http.Request, result *gopay.CallbackResult) { cancelled = result },
+	})
+
+	form := url.Values{"Token": {"900"}, "status": {"-138"}}
+	r := httptest.NewRequest(http.MethodPost, "/callback/parsian", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if cancelled == nil || cancelled.Response.Status != gopay.StatusCancelled || !errors.Is(cancelled.Err, gopay.ErrUserCancelled) {
+		t.Fatalf("OnCancelled result = %+v", cancelled)
+	}
+}
+
+func TestConfirmReportsCancellation(t *testing.T) {
+	d, bank := newTestDriver(t, 0)
+	bank.status = -138
+	resp, err := d.Verify(context.Background(), &gopay.TransactionRef{Authority: "900"})
+	if !errors.Is(err, gopay.ErrUserCancelled) || resp == nil || resp.Status != gopay.StatusCancelled {
+		t.Fatalf("got %+v, %v", resp, err)
+	}
+}
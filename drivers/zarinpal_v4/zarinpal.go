@@ -6,52 +6,124 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"gopay"
+	"github.com/arminmiraftab/GoPay"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
-var Initializer gopay.Initializer = New
+func init() {
+	gopay.Register(driverName, New, Schema)
+	gopay.RegisterMessages(driverName, messages)
+}
+
+// messages پیام‌های دوزبانه کدهای پاسخ زرین‌پال که در کاتالوگ gopay ثبت می‌شوند
+var messages = map[string]gopay.Messages{
+	"-9":  {gopay.LangFa: "خطای اعتبارسنجی اطلاعات ارسالی", gopay.LangEn: "Validation error"},
+	"-10": {gopay.LangFa: "آی‌پی یا مرچنت کد پذیرنده صحیح نیست", gopay.LangEn: "Terminal is not valid, check merchant_id or IP address"},
+	"-11": {gopay.LangFa: "مرچنت کد فعال نیست", gopay.LangEn: "Terminal is not active"},
+	"-12": {gopay.LangFa: "تلاش بیش از حد در یک بازه زمانی کوتاه", gopay.LangEn: "Too many attempts, please try again later"},
+	"-15": {gopay.LangFa: "درگاه پرداخت به حالت تعلیق درآمده است", gopay.LangEn: "Terminal has been suspended"},
+	"-16": {gopay.LangFa: "سطح تأیید پذیرنده پایین‌تر از سطح نقره‌ای است", gopay.LangEn: "Terminal authorization level is lower than silver"},
+	"-17": {gopay.LangFa: "محدودیت پذیرنده در سطح آبی", gopay.LangEn: "Terminal is limited to the blue level"},
+	"-50": {gopay.LangFa: "مبلغ پرداخت شده با مقدار مبلغ در وریفای متفاوت است", gopay.LangEn: "Session amount does not match the verify amount"},
+	"-51": {gopay.LangFa: "پرداخت ناموفق", gopay.LangEn: "Session is not valid, payment was not successful"},
+	"-52": {gopay.LangFa: "خطای غیر منتظره؛ با پشتیبانی زرین‌پال تماس بگیرید", gopay.LangEn: "Unexpected error, contact Zarinpal support"},
+	"-53": {gopay.LangFa: "پرداخت متعلق به این مرچنت کد نیست", gopay.LangEn: "Session does not belong to this merchant"},
+	"-54": {gopay.LangFa: "اتوریتی نامعتبر است", gopay.LangEn: "Invalid authority"},
+	"-55": {gopay.LangFa: "تراکنش مورد نظر یافت نشد", gopay.LangEn: "Transaction not found"},
+	"100": {gopay.LangFa: "عملیات موفق", gopay.LangEn: "Success"},
+	"101": {gopay.LangFa: "تراکنش قبلاً وریفای شده است", gopay.LangEn: "Transaction has already been verified"},
+}
+
+// Schema کلیدهای پیکربندی درایور زرین‌پال
+var Schema = gopay.ConfigSchema{
+	{Key: "merchant_id", Type: gopay.FieldString, Required: true, Description: "Zarinpal merchant ID (UUID)"},
+	{Key: "sandbox", Type: gopay.FieldBool, Default: "false", Description: "use the sandbox gateway"},
+	{Key: "timeout", Type: gopay.FieldDuration, Default: "20s", Description: "HTTP client timeout"},
+	{Key: "access_token", Type: gopay.FieldString, Secret: true, Description: "Zarinpal panel access token, required for refunds"},
+}
 
 const (
+	driverName = "zarinpal_v4"
+
 	// آدرس‌های API اصلی (Production)
 	apiPurchaseURL = "https://api.zarinpal.com/pg/v4/payment/request.json"
 	apiVerifyURL   = "https://api.zarinpal.com/pg/v4/payment/verify.json"
+	apiInquiryURL  = "https://api.zarinpal.com/pg/v4/payment/inquiry.json"
 	paymentURL     = "https://www.zarinpal.com/pg/StartPay/"
+	// بازپرداخت فقط از طریق GraphQL پنل و با access token انجام می‌شود و سندباکس ندارد
+	apiGraphQLURL = "https://next.zarinpal.com/api/v4/graphql/"
 
 	// ✅ اصلاح شد: استفاده از آدرس‌های صحیح و به‌روز سندباکس
 	apiSandboxPurchaseURL = "https://sandbox.zarinpal.com/pg/services/WebGate/PaymentRequest.json"
 	apiSandboxVerifyURL   = "https://sandbox.zarinpal.com/pg/services/WebGate/PaymentVerification.json"
 	sandboxPaymentURL     = "https://sandbox.zarinpal.com/pg/StartPay/"
+	// سرویس قدیمی WebGate استعلام ندارد، پس استعلام سندباکس از API نسخه ۴ انجام می‌شود
+	apiSandboxInquiryURL = "https://sandbox.zarinpal.com/pg/v4/payment/inquiry.json"
 )
 
 type Driver struct {
-	MerchantID string
-	IsSandbox  bool
-	Client     *http.Client
+	MerchantID  string
+	AccessToken string
+	IsSandbox   bool
+	Client      *http.Client
+	Retry       gopay.RetryPolicy
 }
 
 var _ gopay.Driver = (*Driver)(nil)
 var _ gopay.RedirectPayer = (*Driver)(nil)
+var _ gopay.UnitDeclarer = (*Driver)(nil)
+var _ gopay.CallbackIdentifier = (*Driver)(nil)
+var _ gopay.Inquirer = (*Driver)(nil)
+var _ gopay.RefVerifier = (*Driver)(nil)
+var _ gopay.PartialRefunder = (*Driver)(nil)
+var _ gopay.RetrySafety = (*Driver)(nil)
+var _ gopay.RetryConfigurable = (*Driver)(nil)
 
 func New(config gopay.DriverConfig) (gopay.Driver, error) {
 	merchantID, ok := config["merchant_id"]
 	if !ok {
 		return nil, fmt.Errorf("zarinpal_v4 config is missing 'merchant_id'")
 	}
-	isSandbox, _ := strconv.ParseBool(config["sandbox"])
+	isSandbox, err := config.Bool("sandbox")
+	if err != nil {
+		return nil, fmt.Errorf("zarinpal_v4 config 'sandbox' is invalid: %w", err)
+	}
+	timeout, err := config.Duration("timeout")
+	if err != nil {
+		return nil, fmt.Errorf("zarinpal_v4 config 'timeout' is invalid: %w", err)
+	}
+	if timeout == 0 {
+		timeout = 20 * time.Second
+	}
 	return &Driver{
-		MerchantID: merchantID,
-		IsSandbox:  isSandbox,
-		Client:     &http.Client{},
+		MerchantID:  merchantID,
+		AccessToken: config["access_token"],
+		IsSandbox:   isSandbox,
+		Client:      &http.Client{Timeout: timeout},
 	}, nil
 }
 
 func (d *Driver) GetName() string {
-	return "zarinpal_v4"
+	return driverName
+}
+
+// IsRetrySafe تأیید و استعلام زرین‌پال idempotent هستند؛ درخواست پرداخت هر بار Authority جدید می‌سازد
+func (d *Driver) IsRetrySafe(op gopay.Operation) bool {
+	return op == gopay.OpVerify || op == gopay.OpInquiry
+}
+
+func (d *Driver) SetRetryPolicy(policy gopay.RetryPolicy) {
+	d.Retry = policy
+}
+
+// AmountUnit زرین‌پال مبالغ را به تومان دریافت می‌کند
+func (d *Driver) AmountUnit() gopay.Unit {
+	return gopay.Toman
 }
 
 func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*gopay.PaymentResponse, error) {
@@ -65,37 +137,42 @@ func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*
 		purchaseURL = apiSandboxPurchaseURL
 	}
 
+	amount, err := req.Amount.In(d.AmountUnit())
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidAmount, Err: err, Message: "invalid amount"}
+	}
+
 	// برای سندباکس از فرمت قدیمی (form) و برای API اصلی از JSON استفاده می‌کنیم
 	if d.IsSandbox {
 		data := url.Values{}
 		data.Set("MerchantID", d.MerchantID)
-		data.Set("Amount", strconv.FormatInt(req.Amount/10, 10))
+		data.Set("Amount", strconv.FormatInt(amount, 10))
 		data.Set("CallbackURL", req.CallbackURL)
 		data.Set("Description", req.Description)
 
 		httpReq, err = http.NewRequestWithContext(ctx, "POST", purchaseURL, strings.NewReader(data.Encode()))
 		if err != nil {
-			return nil, &gopay.GatewayError{Err: err}
+			return nil, &gopay.GatewayError{Driver: driverName, Err: err}
 		}
 		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	} else {
 		payload := map[string]interface{}{
 			"merchant_id":  d.MerchantID,
-			"amount":       req.Amount / 10,
+			"amount":       amount,
 			"callback_url": req.CallbackURL,
 			"description":  req.Description,
 		}
 		body, _ := json.Marshal(payload)
 		httpReq, err = http.NewRequestWithContext(ctx, "POST", purchaseURL, strings.NewReader(string(body)))
 		if err != nil {
-			return nil, &gopay.GatewayError{Err: err}
+			return nil, &gopay.GatewayError{Driver: driverName, Err: err}
 		}
 		httpReq.Header.Set("Content-Type", "application/json")
 	}
 
 	resp, err := d.Client.Do(httpReq)
 	if err != nil {
-		return nil, &gopay.GatewayError{Err: err}
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err}
 	}
 	defer resp.Body.Close()
 
@@ -107,31 +184,539 @@ func (d *Driver) Purchase(ctx context.Context, req *gopay.TransactionRequest) (*
 			Authority string `json:"Authority"`
 		}
 		if err := json.Unmarshal(respBody, &result); err != nil {
-			return nil, &gopay.GatewayError{Err: err, Message: "failed to unmarshal sandbox response"}
+			return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to unmarshal sandbox response"}
 		}
 		if result.Status != 100 {
-			return nil, &gopay.GatewayError{Code: result.Status, Message: fmt.Sprintf("sandbox error code: %d", result.Status)}
+			return nil, zarinpalError(result.Status, "")
+		}
+		return &gopay.PaymentResponse{
+			Authority:      result.Authority,
+			PaymentURL:     startPayURL + result.Authority,
+			RedirectMethod: gopay.RedirectGET,
+		}, nil
+	}
+
+	// منطق پاسخ API اصلی
+	var data struct {
+		Authority string `json:"authority"`
+	}
+	if err := decodeAPIResponse(respBody, &data); err != nil {
+		return nil, err
+	}
+	return &gopay.PaymentResponse{
+		Authority:      data.Authority,
+		PaymentURL:     startPayURL + data.Authority,
+		RedirectMethod: gopay.RedirectGET,
+	}, nil
+}
+
+// CallbackKey کلید تراکنش (Authority) را از callback زرین‌پال برمی‌گرداند
+func (d *Driver) CallbackKey(r *http.Request) string {
+	return r.URL.Query().Get("Authority")
+}
+
+func (d *Driver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher gopay.TransactionFetcher) (*gopay.VerificationResponse, error) {
+	// زرین‌پال پارامترها را با متد GET به CallbackURL برمی‌گرداند
+	authority := r.URL.Query().Get("Authority")
+	status := r.URL.Query().Get("Status")
+
+	if authority == "" {
+		return &gopay.VerificationResponse{Status: gopay.StatusInvalid}, nil
+	}
+	if status != "OK" {
+		// تراکنش توسط کاربر لغو شده یا ناموفق بوده
+		return &gopay.VerificationResponse{
+			Status:       gopay.StatusCancelled,
+			OriginalData: map[string]interface{}{"Authority": authority, "Status": status},
+		}, nil
+	}
+
+	original, err := fetcher(ctx, authority)
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to fetch original transaction"}
+	}
+	return d.verify(ctx, authority, original.Amount)
+}
+
+// Verify پرداخت انجام‌شده با ref.Authority را بدون callback و با مبلغ ref.Amount تأیید
+// می‌کند (gopay.RefVerifier)؛ تأیید دوباره کد ۱۰۱ و StatusAlreadyVerified برمی‌گرداند
+func (d *Driver) Verify(ctx context.Context, ref *gopay.TransactionRef) (*gopay.VerificationResponse, error) {
+	if ref.Authority == "" || ref.Amount.IsZero() {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Message: "authority and amount are required for verify"}
+	}
+	return d.verify(ctx, ref.Authority, ref.Amount)
+}
+
+// verify درخواست تأیید Authority با مبلغ سفارش را به API اصلی یا سندباکس می‌فرستد
+func (d *Driver) verify(ctx context.Context, authority string, original gopay.Money) (*gopay.VerificationResponse, error) {
+	amount, err := original.In(d.AmountUnit())
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidAmount, Err: err, Message: "invalid original transaction amount"}
+	}
+
+	verifyURL, contentType, reqBody := apiVerifyURL, "application/json", ""
+	if d.IsSandbox {
+		data := url.Values{}
+		data.Set("MerchantID", d.MerchantID)
+		data.Set("Authority", authority)
+		data.Set("Amount", strconv.FormatInt(amount, 10))
+
+		verifyURL, contentType, reqBody = apiSandboxVerifyURL, "application/x-www-form-urlencoded", data.Encode()
+	} else {
+		payload := map[string]interface{}{
+			"merchant_id": d.MerchantID,
+			"amount":      amount,
+			"authority":   authority,
 		}
-		return &gopay.PaymentResponse{Authority: result.Authority, PaymentURL: startPayURL + result.Authority}, nil
+		body, _ := json.Marshal(payload)
+		reqBody = string(body)
+	}
+
+	// تأیید با Authority یکسان idempotent است (کد ۱۰۱)، پس خطای شبکه با سیاست تکرار دوباره ارسال می‌شود
+	var respBody []byte
+	err = gopay.Retry(ctx, d.Retry, d, gopay.OpVerify, func(ctx context.Context) error {
+		respBody, err = d.post(ctx, verifyURL, contentType, reqBody)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if d.IsSandbox {
+		var result struct {
+			Status int         `json:"Status"`
+			RefID  json.Number `json:"RefID"`
+		}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to unmarshal sandbox verify response"}
+		}
+		verifyStatus := verifyCodeToStatus(result.Status)
+		if verifyStatus == gopay.StatusFailed {
+			return &gopay.VerificationResponse{Status: gopay.StatusFailed},
+				zarinpalError(result.Status, "")
+		}
+		return &gopay.VerificationResponse{
+			Status:       verifyStatus,
+			ReferenceID:  result.RefID.String(),
+			OriginalData: map[string]interface{}{"Authority": authority, "Status": result.Status},
+		}, nil
 	}
 
 	// منطق پاسخ API اصلی
+	var data struct {
+		Code    int         `json:"code"`
+		Message string      `json:"message"`
+		RefID   json.Number `json:"ref_id"`
+		CardPan string      `json:"card_pan"`
+	}
+	if err := decodeAPIResponse(respBody, &data); err != nil {
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed}, err
+	}
+
+	verifyStatus := verifyCodeToStatus(data.Code)
+	if verifyStatus == gopay.StatusFailed {
+		return &gopay.VerificationResponse{Status: gopay.StatusFailed},
+			zarinpalError(data.Code, data.Message)
+	}
+
+	return &gopay.VerificationResponse{
+		Status:      verifyStatus,
+		ReferenceID: data.RefID.String(),
+		CardNumber:  data.CardPan,
+		Message:     data.Message,
+		OriginalData: map[string]interface{}{
+			"Authority": authority,
+			"Code":      data.Code,
+		},
+	}, nil
+}
+
+// Inquire وضعیت تراکنش را با payment/inquiry.json استعلام می‌کند. زرین‌پال در پاسخ
+// استعلام مبلغ و شماره مرجع را برنمی‌گرداند، پس این فیلدها خالی می‌مانند.
+func (d *Driver) Inquire(ctx context.Context, ref *gopay.TransactionRef) (*gopay.InquiryResponse, error) {
+	if ref.Authority == "" {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Message: "authority is required for inquiry"}
+	}
+
+	inquiryURL := apiInquiryURL
+	if d.IsSandbox {
+		inquiryURL = apiSandboxInquiryURL
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"merchant_id": d.MerchantID,
+		"authority":   ref.Authority,
+	})
+
+	var respBody []byte
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpInquiry, func(ctx context.Context) error {
+		var err error
+		respBody, err = d.post(ctx, inquiryURL, "application/json", string(body))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	}
+	if err := decodeAPIResponse(respBody, &data); err != nil {
+		return nil, err
+	}
+	if data.Code != 100 {
+		return nil, zarinpalError(data.Code, data.Message)
+	}
+
+	return &gopay.InquiryResponse{
+		Status:  inquiryStatusToStatus(data.Status),
+		Message: data.Message,
+		OriginalData: map[string]interface{}{
+			"Authority": ref.Authority,
+			"Status":    data.Status,
+		},
+	}, nil
+}
+
+// inquiryStatusToStatus وضعیت متنی استعلام زرین‌پال را به وضعیت gopay تبدیل می‌کند
+func inquiryStatusToStatus(status string) gopay.VerificationStatus {
+	switch status {
+	case "PAID":
+		return gopay.StatusSuccess
+	case "VERIFIED":
+		return gopay.StatusAlreadyVerified
+	case "IN_BANK":
+		return gopay.StatusPending
+	case "REVERSED":
+		return gopay.StatusReversed
+	default:
+		return gopay.StatusFailed
+	}
+}
+
+// refundMutation ثبت بازپرداخت در GraphQL زرین‌پال؛ session_id شناسه تراکنش در پنل است
+const refundMutation = `mutation AddRefund($session_id: ID!, $amount: BigInteger!, $description: String, $method: InstantPayoutActionTypeEnum, $reason: RefundReasonEnum) {
+  resource: AddRefund(session_id: $session_id, amount: $amount, description: $description, method: $method, reason: $reason) {
+    terminal_id
+    id
+    amount
+    timeline {
+      refund_amount
+      refund_time
+      refund_status
+    }
+  }
+}`
+
+// SupportsPartialRefund زرین‌پال بازپرداخت بخشی از مبلغ تراکنش را می‌پذیرد
+func (d *Driver) SupportsPartialRefund() bool {
+	return true
+}
+
+// Refund بازپرداخت کامل یا جزئی را با AddRefund ثبت می‌کند. TransactionRefID همان
+// session_id تراکنش در پنل زرین‌پال است و اگر خالی باشد با query ِ Session از ref_id
+// تأیید (ReferenceID) پیدا می‌شود. مبلغ بازپرداخت برخلاف پرداخت به ریال ارسال می‌شود.
+// درخواست تکرار نمی‌شود، چون هر فراخوانی یک بازپرداخت جدید ثبت می‌کند.
+func (d *Driver) Refund(ctx context.Context, req *gopay.RefundRequest) (*gopay.RefundResponse, error) {
+	if d.IsSandbox {
+		return nil, &gopay.GatewayError{Driver: driverName, Err: gopay.ErrUnsupportedOperation, Message: "refund is not available in sandbox"}
+	}
+	if d.AccessToken == "" {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrAuthFailed, Message: "zarinpal_v4 config is missing 'access_token'"}
+	}
+	if req.Amount.Rials() <= 0 {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidAmount, Message: "invalid refund amount"}
+	}
+	sessionID := req.TransactionRefID
+	if sessionID == "" {
+		if req.ReferenceID == "" {
+			return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Message: "session id (TransactionRefID) or verify ref_id (ReferenceID) is required for refund"}
+		}
+		var err error
+		if sessionID, err = d.sessionID(ctx, req.ReferenceID); err != nil {
+			return nil, err
+		}
+	}
+
+	method := req.Method
+	if method == "" {
+		method = gopay.RefundInstant
+	}
+	respBody, err := d.graphql(ctx, refundMutation, map[string]interface{}{
+		"session_id":  sessionID,
+		"amount":      req.Amount.Rials(),
+		"description": req.Description,
+		"method":      refundMethods[method],
+		"reason":      refundReason(req.Reason),
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	var result struct {
 		Data struct {
-			Authority string `json:"authority"`
+			Resource *struct {
+				ID       json.Number `json:"id"`
+				Amount   int64       `json:"amount"`
+				Timeline struct {
+					RefundAmount int64  `json:"refund_amount"`
+					RefundTime   string `json:"refund_time"`
+					RefundStatus string `json:"refund_status"`
+				} `json:"timeline"`
+			} `json:"resource"`
 		} `json:"data"`
-		Errors json.RawMessage `json:"errors"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
 	}
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, &gopay.GatewayError{Err: err, Message: "failed to unmarshal gateway response"}
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to unmarshal refund response"}
+	}
+	if len(result.Errors) > 0 || result.Data.Resource == nil {
+		message := "refund was not registered"
+		if len(result.Errors) > 0 {
+			message = result.Errors[0].Message
+		}
+		return &gopay.RefundResponse{Status: gopay.RefundFailed, Message: message},
+			&gopay.GatewayError{Driver: driverName, Message: message}
+	}
+
+	resource := result.Data.Resource
+	amount := resource.Timeline.RefundAmount
+	if amount == 0 {
+		amount = req.Amount.Rials()
+	}
+	refundStatus := refundStatusToStatus(resource.Timeline.RefundStatus)
+	requestedAt, err := time.Parse(time.RFC3339, resource.Timeline.RefundTime)
+	if err != nil {
+		requestedAt = time.Now()
+	}
+	resp := &gopay.RefundResponse{
+		IsSuccess:   refundStatus != gopay.RefundFailed,
+		RefundID:    resource.ID.String(),
+		Amount:      gopay.Rials(amount),
+		Method:      method,
+		Status:      refundStatus,
+		Message:     resource.Timeline.RefundStatus,
+		RequestedAt: requestedAt,
+		OriginalData: map[string]interface{}{
+			"SessionID":    sessionID,
+			"RefundStatus": resource.Timeline.RefundStatus,
+		},
 	}
-	if len(result.Errors) > 2 {
-		return nil, &gopay.GatewayError{Message: fmt.Sprintf("zarinpal error: %s", string(result.Errors))}
+	if refundStatus == gopay.RefundCompleted {
+		resp.CompletedAt = requestedAt
 	}
-	return &gopay.PaymentResponse{Authority: result.Data.Authority, PaymentURL: startPayURL + result.Data.Authority}, nil
+	return resp, nil
 }
 
-func (d *Driver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher gopay.TransactionFetcher) (*gopay.VerificationResponse, error) {
-	// ... این بخش نیز باید مشابه Purchase برای سندباکس اصلاح شود ...
-	return &gopay.VerificationResponse{Status: gopay.StatusSuccess}, nil
+// sessionQuery جلسه پرداخت (session) پنل زرین‌پال را با ref_id تأیید پیدا می‌کند
+const sessionQuery = `query Session($reference_id: String) {
+  resource: Session(reference_id: $reference_id) {
+    id
+  }
+}`
+
+// sessionID شناسه session تراکنش با ref_id تأیید refID را از پنل زرین‌پال می‌خواند.
+// این query فقط خواندنی است و با سیاست تکرار استعلام دوباره ارسال می‌شود.
+func (d *Driver) sessionID(ctx context.Context, refID string) (string, error) {
+	var respBody []byte
+	err := gopay.Retry(ctx, d.Retry, d, gopay.OpInquiry, func(ctx context.Context) error {
+		var err error
+		respBody, err = d.graphql(ctx, sessionQuery, map[string]interface{}{"reference_id": refID})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Data struct {
+			Resource []struct {
+				ID json.Number `json:"id"`
+			} `json:"resource"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to unmarshal session response"}
+	}
+	if len(result.Errors) > 0 {
+		return "", &gopay.GatewayError{Driver: driverName, Message: result.Errors[0].Message}
+	}
+	if len(result.Data.Resource) == 0 || result.Data.Resource[0].ID == "" {
+		return "", &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrInvalidTransaction, Message: "no Zarinpal session found for ref_id " + refID}
+	}
+	return result.Data.Resource[0].ID.String(), nil
+}
+
+// graphql درخواست را با access token به GraphQL پنل زرین‌پال می‌فرستد و بدنه پاسخ را برمی‌گرداند
+func (d *Driver) graphql(ctx context.Context, query string, variables map[string]interface{}) ([]byte, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiGraphQLURL, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+d.AccessToken)
+
+	respBody, status, err := d.send(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return nil, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrAuthFailed, Message: "access token was rejected"}
+	}
+	return respBody, nil
+}
+
+// refundMethods روش‌های واریز gopay به مقادیر InstantPayoutActionTypeEnum
+var refundMethods = map[gopay.RefundMethod]string{
+	gopay.RefundInstant: "CARD",
+	gopay.RefundPAYA:    "PAYA",
+}
+
+// refundReason دلیل بازپرداخت را به RefundReasonEnum زرین‌پال تبدیل می‌کند
+func refundReason(reason gopay.RefundReason) string {
+	switch reason {
+	case gopay.RefundReasonCustomerRequest:
+		return "CUSTOMER_REQUEST"
+	case gopay.RefundReasonDuplicate:
+		return "DUPLICATE_TRANSACTION"
+	case gopay.RefundReasonSuspicious:
+		return "SUSPICIOUS_TRANSACTION"
+	default:
+		return "OTHER"
+	}
+}
+
+// refundStatusToStatus وضعیت بازپرداخت زرین‌پال را به وضعیت gopay تبدیل می‌کند
+func refundStatusToStatus(status string) gopay.RefundStatus {
+	switch status {
+	case "DONE", "COMPLETED":
+		return gopay.RefundCompleted
+	case "FAILED", "REJECTED", "CANCELED":
+		return gopay.RefundFailed
+	default:
+		return gopay.RefundPending
+	}
+}
+
+// post درخواست را ارسال و بدنه پاسخ را برمی‌گرداند؛ خطای انتقال با دسته ErrGatewayUnavailable برچسب می‌خورد
+func (d *Driver) post(ctx context.Context, endpoint, contentType, body string) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, &gopay.GatewayError{Driver: driverName, Err: err}
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+
+	respBody, _, err := d.send(httpReq)
+	return respBody, err
+}
+
+// send درخواست آماده را اجرا و بدنه و کد HTTP پاسخ را برمی‌گرداند؛ خطای انتقال و
+// پاسخ 5xx با دسته ErrGatewayUnavailable برچسب می‌خورند
+func (d *Driver) send(httpReq *http.Request) ([]byte, int, error) {
+	resp, err := d.Client.Do(httpReq)
+	if err != nil {
+		return nil, 0, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Err: err}
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, resp.StatusCode, &gopay.GatewayError{Driver: driverName, Kind: gopay.ErrGatewayUnavailable, Message: fmt.Sprintf("unexpected http status %d", resp.StatusCode)}
+	}
+	return respBody, resp.StatusCode, nil
+}
+
+// decodeAPIResponse پاسخ API اصلی را می‌خواند و فیلد data را در out می‌ریزد. زرین‌پال
+// در پاسخ خطا data و در پاسخ موفق errors را آرایه خالی برمی‌گرداند، پس هر دو ابتدا
+// خام خوانده می‌شوند؛ خطای گزارش‌شده در errors به GatewayError تبدیل می‌شود.
+func decodeAPIResponse(body []byte, out interface{}) error {
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to unmarshal gateway response"}
+	}
+	if len(envelope.Errors) > 2 {
+		return errorsToGatewayError(envelope.Errors)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return &gopay.GatewayError{Driver: driverName, Err: err, Message: "failed to unmarshal gateway response data"}
+	}
+	return nil
+}
+
+// errorsToGatewayError فیلد errors پاسخ API اصلی ({"code": -9, "message": "..."}) را به GatewayError تبدیل می‌کند
+func errorsToGatewayError(raw json.RawMessage) *gopay.GatewayError {
+	var e struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &e); err != nil || e.Code == 0 {
+		return &gopay.GatewayError{Driver: driverName, Message: fmt.Sprintf("zarinpal error: %s", string(raw))}
+	}
+	return zarinpalError(e.Code, e.Message)
+}
+
+// zarinpalError اگر پیام درگاه خالی باشد، پیام فارسی کد از کاتالوگ استفاده می‌شود
+func zarinpalError(code int, message string) *gopay.GatewayError {
+	if message == "" {
+		if text, ok := gopay.DefaultCatalog.CodeMessage(driverName, strconv.Itoa(code), gopay.LangFa); ok {
+			message = text
+		} else {
+			message = fmt.Sprintf("zarinpal error code: %d", code)
+		}
+	}
+	return &gopay.GatewayError{
+		Driver:  driverName,
+		Code:    code,
+		Kind:    zarinpalCodeToKind(code),
+		Message: message,
+	}
+}
+
+func zarinpalCodeToKind(code int) error {
+	switch code {
+	case -10:
+		return gopay.ErrIPNotWhitelisted
+	case -11, -12, -15, -16, -17:
+		return gopay.ErrAuthFailed
+	case -50:
+		return gopay.ErrAmountMismatch
+	case -51:
+		return gopay.ErrUserCancelled
+	case -52:
+		return gopay.ErrGatewayUnavailable
+	case -53, -54, -55:
+		return gopay.ErrInvalidTransaction
+	case 101:
+		return gopay.ErrAlreadyVerified
+	default:
+		return nil
+	}
+}
+
+// verifyCodeToStatus کد پاسخ Verify زرین‌پال را به وضعیت gopay تبدیل می‌کند
+func verifyCodeToStatus(code int) gopay.VerificationStatus {
+	switch code {
+	case 100:
+		return gopay.StatusSuccess
+	case 101:
+		return gopay.StatusAlreadyVerified
+	default:
+		return gopay.StatusFailed
+	}
 }
@@ -0,0 +1,224 @@
+package zarinpal_v4
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arminmiraftab/GoPay"
+)
+
+// fakeAPI پاسخ JSON هر endpoint (مثل verify.json) را برمی‌گرداند و بدنه درخواست‌ها را ثبت می‌کند.
+// درخواست‌های GraphQL با نام عملیات ثبت و پاسخ داده می‌شوند (مثلاً "graphql:Session").
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses map[string]string
+	requests  map[string][]map[string]interface{}
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := path.Base(r.URL.Path)
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	if query, ok := body["query"].(string); ok {
+		if fields := strings.Fields(query); len(fields) > 1 {
+			endpoint += ":" + strings.SplitN(fields[1], "(", 2)[0]
+		}
+	}
+	a.mu.Lock()
+	a.requests[endpoint] = append(a.requests[endpoint], body)
+	resp, ok := a.responses[endpoint]
+	a.mu.Unlock()
+	if !ok {
+		http.Error(w, "unexpected endpoint "+endpoint, http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(resp))
+}
+
+func (a *fakeAPI) calls(endpoint string) []map[string]interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests[endpoint]
+}
+
+// redirect همه درخواست‌ها را به سرور تست می‌فرستد
+type redirect struct{ target *url.URL }
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestDriver(t *testing.T, responses map[string]string) (*Driver, *fakeAPI) {
+	t.Helper()
+	api := &fakeAPI{responses: responses, requests: make(map[string][]map[string]interface{})}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	return &Driver{MerchantID: "merchant", Client: &http.Client{Transport: redirect{target}}}, api
+}
+
+func callback(status string) *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/callback?Authority=A0001&Status="+status, nil)
+}
+
+func fetcher(amount gopay.Money) gopay.TransactionFetcher {
+	return func(context.Context, string) (*gopay.OriginalTransaction, error) {
+		return &gopay.OriginalTransaction{Amount: amount}, nil
+	}
+}
+
+func TestPurchaseSendsTomans(t *testing.T) {
+	d, api := newTestDriver(t, map[string]string{"request.json": `{"data": {"code": 100, "authority": "A0001"}, "errors": []}`})
+	resp, err := d.Purchase(context.Background(), &gopay.TransactionRequest{Amount: gopay.Rials(10000), CallbackURL: "https://shop.test/cb"})
+	if err != nil || resp.Authority != "A0001" {
+		t.Fatalf("got %+v, %v", resp, err)
+	}
+	if sent := api.calls("request.json"); len(sent) != 1 || sent[0]["amount"] != float64(1000) {
+		t.Fatalf("sent %v, want amount 1000 tomans", sent)
+	}
+
+	_, err = d.Purchase(context.Background(), &gopay.TransactionRequest{Amount: gopay.Rials(10005)})
+	if !errors.Is(err, gopay.ErrInvalidAmount) || !errors.Is(err, gopay.ErrPrecisionLoss) {
+		t.Fatalf("err = %v, want ErrInvalidAmount wrapping ErrPrecisionLoss", err)
+	}
+	if len(api.calls("request.json")) != 1 {
+		t.Fatal("amount with precision loss was sent to the gateway")
+	}
+}
+
+func TestVerifyAndConfirm(t *testing.T) {
+	tests := map[string]struct {
+		response string
+		status   gopay.VerificationStatus
+		refID    string
+		wantErr  error
+	}{
+		"success":          {`{"data": {"code": 100, "ref_id": 201, "card_pan": "5022-29**-****-2328"}, "errors": []}`, gopay.StatusSuccess, "201", nil},
+		"already verified": {`{"data": {"code": 101, "ref_id": 201}, "errors": []}`, gopay.StatusAlreadyVerified, "201", nil},
+		"amount mismatch":  {`{"data": [], "errors": {"code": -50, "message": "Session is not valid, amounts values is not the same."}}`, gopay.StatusFailed, "", gopay.ErrAmountMismatch},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, api := newTestDriver(t, map[string]string{"verify.json": tt.response})
+
+			resp, err := d.VerifyAndConfirm(context.Background(), callback("OK"), fetcher(gopay.Rials(10000)))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if resp.Status != tt.status || resp.ReferenceID != tt.refID {
+				t.Fatalf("got status %v ref %q", resp.Status, resp.ReferenceID)
+			}
+
+			// مبلغ سفارش به تومان و با Authority ِ callback ارسال می‌شود
+			sent := api.calls("verify.json")
+			if len(sent) != 1 || sent[0]["amount"] != float64(1000) || sent[0]["authority"] != "A0001" {
+				t.Fatalf("verify request = %v", sent)
+			}
+		})
+	}
+}
+
+func TestVerifyAndConfirmCancelledCallback(t *testing.T) {
+	d, api := newTestDriver(t, nil)
+	resp, err := d.VerifyAndConfirm(context.Background(), callback("NOK"), fetcher(gopay.Rials(10000)))
+	if err != nil || resp.Status != gopay.StatusCancelled {
+		t.Fatalf("got %+v, %v", resp, err)
+	}
+	if len(api.calls("verify.json")) != 0 {
+		t.Fatal("cancelled payment was verified")
+	}
+}
+
+func TestVerifyByRefRequiresAmount(t *testing.T) {
+	d, _ := newTestDriver(t, map[string]string{"verify.json": `{"data": {"code": 101, "ref_id": 7}, "errors": []}`})
+	if _, err := d.Verify(context.Background(), &gopay.TransactionRef{Authority: "A0001"}); !errors.Is(err, gopay.ErrInvalidTransaction) {
+		t.Fatalf("err = %v, want ErrInvalidTransaction", err)
+	}
+	resp, err := d.Verify(context.Background(), &gopay.TransactionRef{Authority: "A0001", ReferenceID: "201", Amount: gopay.Tomans(1000)})
+	if err != nil || resp.Status != gopay.StatusAlreadyVerified {
+		t.Fatalf("got %+v, %v", resp, err)
+	}
+}
+
+func TestInquire(t *testing.T) {
+	tests := map[string]gopay.VerificationStatus{
+		"PAID":     gopay.StatusSuccess,
+		"VERIFIED": gopay.StatusAlreadyVerified,
+		"IN_BANK":  gopay.StatusPending,
+		"REVERSED": gopay.StatusReversed,
+		"FAILED":   gopay.StatusFailed,
+	}
+	for status, want := range tests {
+		d, _ := newTestDriver(t, map[string]string{"inquiry.json": `{"data": {"code": 100, "status": "` + status + `"}, "errors": []}`})
+		resp, err := d.Inquire(context.Background(), &gopay.TransactionRef{Authority: "A0001", ReferenceID: "201", Amount: gopay.Tomans(1000)})
+		if err != nil {
+			t.Fatalf("%s: %v", status, err)
+		}
+		if resp.Status != want {
+			t.Errorf("%s: status %v, want %v", status, resp.Status, want)
+		}
+		// زرین‌پال مبلغ و شماره مرجع را در استعلام برنمی‌گرداند
+		if !resp.Amount.IsZero() || resp.ReferenceID != "" {
+			t.Errorf("%s: amount %s, reference %q copied from the request", status, resp.Amount, resp.ReferenceID)
+		}
+	}
+
+	d, _ := newTestDriver(t, map[string]string{"inquiry.json": `{"data": [], "errors": {"code": -54, "message": "Invalid authority."}}`})
+	if _, err := d.Inquire(context.Background(), &gopay.TransactionRef{Authority: "A0001"}); !errors.Is(err, gopay.ErrInvalidTransaction) {
+		t.Fatalf("err = %v, want ErrInvalidTransaction", err)
+	}
+}
+
+func TestRefundResolvesSessionID(t *testing.T) {
+	d, api := newTestDriver(t, map[string]string{
+		"graphql:Session":   `{"data": {"resource": [{"id": "9001"}]}}`,
+		"graphql:AddRefund": `{"data": {"resource": {"id": 501, "amount": 10000, "timeline": {"refund_amount": 10000, "refund_status": "PENDING"}}}}`,
+	})
+	d.AccessToken = "token"
+
+	resp, err := d.Refund(context.Background(), &gopay.RefundRequest{ReferenceID: "201", Amount: gopay.Rials(10000)})
+	if err != nil || resp.Status != gopay.RefundPending || resp.RefundID != "501" {
+		t.Fatalf("Refund = %+v, %v", resp, err)
+	}
+	lookup := api.calls("graphql:Session")
+	if len(lookup) != 1 || lookup[0]["variables"].(map[string]interface{})["reference_id"] != "201" {
+		t.Fatalf("session lookup = %v", lookup)
+	}
+	refund := api.calls("graphql:AddRefund")
+	if len(refund) != 1 || refund[0]["variables"].(map[string]interface{})["session_id"] != "9001" {
+		t.Fatalf("AddRefund = %v", refund)
+	}
+
+	// session_id صریح بدون جستجو استفاده می‌شود
+	if _, err := d.Refund(context.Background(), &gopay.RefundRequest{TransactionRefID: "9002", Amount: gopay.Rials(10000)}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(api.calls("graphql:Session")); n != 1 {
+		t.Fatalf("session looked up %d times, want 1", n)
+	}
+}
+
+func TestRefundRequiresKnownSession(t *testing.T) {
+	d, api := newTestDriver(t, map[string]string{"graphql:Session": `{"data": {"resource": []}}`})
+	d.AccessToken = "token"
+
+	_, err := d.Refund(context.Background(), &gopay.RefundRequest{ReferenceID: "201", Amount: gopay.Rials(10000)})
+	if !errors.Is(err, gopay.ErrInvalidTransaction) {
+		t.Fatalf("err = %v, want ErrInvalidTransaction", err)
+	}
+	if _, err := d.Refund(context.Background(), &gopay.RefundRequest{Amount: gopay.Rials(10000)}); !errors.Is(err, gopay.ErrInvalidTransaction) {
+		t.Fatalf("missing ref_id: err = %v", err)
+	}
+	if len(api.calls("graphql:AddRefund")) != 0 {
+		t.Fatal("refund was sent without a session id")
+	}
+}
@@ -0,0 +1,21 @@
+package gopay
+
+import "errors"
+
+// دسته‌بندی نرمال‌شده خطاهای درگاه؛ هر درایور کدهای اختصاصی خود را به یکی از این
+// مقادیر نگاشت می‌کند و با errors.Is قابل بررسی هستند:
+//
+//	if errors.Is(err, gopay.ErrInsufficientFunds) { ... }
+var (
+	ErrUserCancelled      = errors.New("payment cancelled by user")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrInvalidCard        = errors.New("invalid card or card credentials")
+	ErrDuplicateOrder     = errors.New("duplicate order")
+	ErrAuthFailed         = errors.New("merchant authentication failed")
+	ErrIPNotWhitelisted   = errors.New("merchant ip is not whitelisted")
+	ErrGatewayUnavailable = errors.New("gateway unavailable")
+	ErrAlreadyVerified    = errors.New("transaction already verified")
+	ErrInvalidAmount      = errors.New("invalid amount")
+	ErrAmountMismatch     = errors.New("amount mismatch")
+	ErrInvalidTransaction = errors.New("invalid or unknown transaction")
+)
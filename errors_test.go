@@ -0,0 +1,37 @@
+package gopay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestGatewayErrorMatchesKindAndCause(t *testing.T) {
+	err := fmt.Errorf("purchase: %w", &GatewayError{Driver: "zarinpal_v4", Code: -11, Kind: ErrAuthFailed, Err: io.ErrUnexpectedEOF})
+
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Error("errors.Is does not match the Kind")
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("errors.Is does not reach the underlying error")
+	}
+	if errors.Is(err, ErrInsufficientFunds) {
+		t.Error("errors.Is matched an unrelated Kind")
+	}
+
+	var gatewayErr *GatewayError
+	if !errors.As(err, &gatewayErr) || gatewayErr.Code != -11 || gatewayErr.Driver != "zarinpal_v4" {
+		t.Fatalf("errors.As = %+v", gatewayErr)
+	}
+}
+
+func TestGatewayErrorWithoutKind(t *testing.T) {
+	err := &GatewayError{Message: "unknown"}
+	if errors.Is(err, ErrGatewayUnavailable) || errors.Unwrap(err) != nil {
+		t.Fatalf("error without Kind or Err matched: %v", err)
+	}
+	if got, want := err.Error(), "gateway error: code=0, msg='unknown', underlying_err=<nil>"; got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
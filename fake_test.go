@@ -0,0 +1,164 @@
+package gopay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriverType درایور ساختگی تست‌های این پکیج که تمام قابلیت‌ها را دارد؛ رفتار هر
+// عملیات با hook مربوط قابل تغییر است و تعداد فراخوانی‌ها شمرده می‌شود
+const fakeDriverType = "fake"
+
+func init() {
+	Register(fakeDriverType, func(config DriverConfig) (Driver, error) {
+		return &fakeDriver{calls: make(map[Operation]int)}, nil
+	}, ConfigSchema{
+		{Key: "label", Type: FieldString, Description: "free-form label used by tests"},
+		{Key: "terminal_id", Type: FieldInt, Description: "numeric test key"},
+	})
+}
+
+type fakeDriver struct {
+	mu    sync.Mutex
+	calls map[Operation]int
+
+	purchase  func(ctx context.Context, req *TransactionRequest) (*PaymentResponse, error)
+	verify    func(ctx context.Context, r *http.Request, fetcher TransactionFetcher) (*VerificationResponse, error)
+	inquire   func(ctx context.Context, ref *TransactionRef) (*InquiryResponse, error)
+	verifyRef func(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error)
+	settle    func(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error)
+	reverse   func(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error)
+	refund    func(ctx context.Context, req *RefundRequest) (*RefundResponse, error)
+	partial   bool
+	numeric   bool
+}
+
+func (d *fakeDriver) count(op Operation) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls[op]++
+	return d.calls[op]
+}
+
+// Calls تعداد فراخوانی عملیات op را برمی‌گرداند
+func (d *fakeDriver) Calls(op Operation) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls[op]
+}
+
+func (d *fakeDriver) GetName() string { return fakeDriverType }
+
+func (d *fakeDriver) CallbackKey(r *http.Request) string { return r.URL.Query().Get("key") }
+
+func (d *fakeDriver) Purchase(ctx context.Context, req *TransactionRequest) (*PaymentResponse, error) {
+	n := d.count(OpPurchase)
+	if d.purchase != nil {
+		return d.purchase(ctx, req)
+	}
+	return &PaymentResponse{Success: true, Authority: fmt.Sprintf("A%d", n), PaymentURL: "https://pay.test/start"}, nil
+}
+
+func (d *fakeDriver) VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher TransactionFetcher) (*VerificationResponse, error) {
+	d.count(OpVerify)
+	if d.verify != nil {
+		return d.verify(ctx, r, fetcher)
+	}
+	key := d.CallbackKey(r)
+	if _, err := fetcher(ctx, key); err != nil {
+		return nil, err
+	}
+	return &VerificationResponse{Status: StatusSuccess, ReferenceID: "R-" + key}, nil
+}
+
+func (d *fakeDriver) Inquire(ctx context.Context, ref *TransactionRef) (*InquiryResponse, error) {
+	d.count(OpInquiry)
+	if d.inquire != nil {
+		return d.inquire(ctx, ref)
+	}
+	return &InquiryResponse{Status: StatusPending}, nil
+}
+
+func (d *fakeDriver) Verify(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error) {
+	d.count(OpVerify)
+	if d.verifyRef != nil {
+		return d.verifyRef(ctx, ref)
+	}
+	return &VerificationResponse{Status: StatusSuccess, ReferenceID: ref.ReferenceID}, nil
+}
+
+func (d *fakeDriver) Settle(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error) {
+	d.count(OpSettle)
+	if d.settle != nil {
+		return d.settle(ctx, ref)
+	}
+	return &VerificationResponse{Status: StatusSuccess, ReferenceID: ref.ReferenceID}, nil
+}
+
+func (d *fakeDriver) Reverse(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error) {
+	d.count(OpReverse)
+	if d.reverse != nil {
+		return d.reverse(ctx, ref)
+	}
+	return &VerificationResponse{Status: StatusReversed, ReferenceID: ref.ReferenceID, Reversal: &ReversalResult{Reversed: true}}, nil
+}
+
+func (d *fakeDriver) Refund(ctx context.Context, req *RefundRequest) (*RefundResponse, error) {
+	n := d.count(OpRefund)
+	if d.refund != nil {
+		return d.refund(ctx, req)
+	}
+	return &RefundResponse{IsSuccess: true, RefundID: fmt.Sprintf("F%d", n), Amount: req.Amount, Status: RefundCompleted}, nil
+}
+
+func (d *fakeDriver) SupportsPartialRefund() bool { return d.partial }
+
+func (d *fakeDriver) RequiresNumericOrderID() bool { return d.numeric }
+
+// newTestClient یک Client با یک درایور fake به ازای هر نام می‌سازد
+func newTestClient(t *testing.T, names []string, opts ...Option) *Client {
+	t.Helper()
+	config := &Config{Drivers: make(map[string]DriverConfig, len(names))}
+	for _, name := range names {
+		config.Drivers[name] = DriverConfig{DriverTypeKey: fakeDriverType}
+	}
+	c, err := NewClient(config, opts...)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return c
+}
+
+// fakeOf نمونه درایور fake با نام name را از Client برمی‌گرداند
+func fakeOf(t *testing.T, c *Client, name string) *fakeDriver {
+	t.Helper()
+	driver, err := c.GetDriver(name)
+	if err != nil {
+		t.Fatalf("GetDriver(%s): %v", name, err)
+	}
+	return driver.(*fakeDriver)
+}
+
+// fakeClock ساعت ساختگی تست‌ها
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time                       { return c.now }
+func (c *fakeClock) After(time.Duration) <-chan time.Time { return nil }
+
+// purchaseTx یک پرداخت با درایور name ایجاد و تراکنش ذخیره‌شده آن را برمی‌گرداند
+func purchaseTx(t *testing.T, c *Client, name string) *Transaction {
+	t.Helper()
+	resp, err := c.Purchase(context.Background(), name, &TransactionRequest{Amount: Rials(10000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := c.Store().FindByAuthority(context.Background(), name, resp.Authority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
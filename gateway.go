@@ -4,22 +4,69 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type Driver interface {
 	GetName() string
 }
 
-type RedirectPayer interface {
+// Purchaser درایورهایی که می‌توانند تراکنش جدید ایجاد کنند
+type Purchaser interface {
 	Purchase(ctx context.Context, req *TransactionRequest) (*PaymentResponse, error)
+}
+
+// Verifier درایورهایی که callback درگاه را تأیید و نهایی می‌کنند
+type Verifier interface {
 	VerifyAndConfirm(ctx context.Context, r *http.Request, fetcher TransactionFetcher) (*VerificationResponse, error)
 }
+
+type RedirectPayer interface {
+	Purchaser
+	Verifier
+}
+
+// CallbackIdentifier درایورهایی که کلید تراکنش (همان کلیدی که به TransactionFetcher
+// داده می‌شود) را پیش از Verify از callback استخراج می‌کنند
+type CallbackIdentifier interface {
+	CallbackKey(r *http.Request) string
+}
+
+// Settler درایورهایی که مرحله تسویه (Settle) را جدا از Verify در اختیار می‌گذارند
+type Settler interface {
+	Settle(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error)
+}
+
+// Reverser درایورهایی که می‌توانند تراکنش تأییدشده ولی تسویه‌نشده را برگشت بزنند
+type Reverser interface {
+	Reverse(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error)
+}
+
+// RefVerifier درایورهایی که پرداخت انجام‌شده را بدون درخواست callback و فقط با
+// شناسه‌های تراکنش تأیید می‌کنند (مثلاً در Reconciler)
+type RefVerifier interface {
+	Verify(ctx context.Context, ref *TransactionRef) (*VerificationResponse, error)
+}
+
+// Inquirer درایورهایی که وضعیت یک تراکنش را از درگاه استعلام می‌کنند
+type Inquirer interface {
+	Inquire(ctx context.Context, ref *TransactionRef) (*InquiryResponse, error)
+}
+
+// PartialRefunder درایورهای Refundable که بازپرداخت جزئی را پشتیبانی می‌کنند
+type PartialRefunder interface {
+	Refundable
+	SupportsPartialRefund() bool
+}
 type PaymentResponse struct {
 	// فیلدهای درخواستی شما
 	Success        bool              `json:"success"`              // آیا درخواست موفق بود
 	Message        string            `json:"message"`              // پیام خطا یا موفقیت
 	PaymentURL     string            `json:"paymentURL,omitempty"` // آدرس درگاه (جایگزین PaymentURL)
 	Authority      string            `json:"authority,omitempty"`
+	OrderID        string            `json:"orderID,omitempty"`        // شماره سفارشی که به درگاه ارسال شد
+	Driver         string            `json:"driver,omitempty"`         // نام درایوری در Client که Authority را صادر کرد
 	RedirectMethod string            `json:"redirectMethod,omitempty"` // متد هدایت کاربر ("GET" or "POST")
 	RedirectParams map[string]string `json:"redirectParams,omitempty"` // پارامترها (مخصوصاً برای POST)
 }
@@ -29,16 +76,50 @@ type Refundable interface {
 }
 
 type TransactionRequest struct {
-	Amount         int64
+	Amount         Money
 	CallbackURL    string
 	Description    string
 	IdempotencyKey string
+	OrderID        int64 // شماره سفارش عددی برای درگاه‌هایی مثل ملت و پارسیان؛ در Client خودکار پر می‌شود
+}
+
+// NumericOrderID شماره سفارش عددی درخواست را برمی‌گرداند: OrderID در صورت تنظیم،
+// و گرنه IdempotencyKey اگر به صورت عدد باشد.
+func (r *TransactionRequest) NumericOrderID() (int64, error) {
+	if r.OrderID != 0 {
+		return r.OrderID, nil
+	}
+	id, err := strconv.ParseInt(r.IdempotencyKey, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("numeric OrderID is required (set OrderID or use a numeric IdempotencyKey)")
+	}
+	return id, nil
 }
 
 type TransactionFetcher func(ctx context.Context, authority string) (*OriginalTransaction, error)
 
 type OriginalTransaction struct {
-	Amount int64
+	Amount Money
+}
+
+// TransactionRef شناسه‌های یک تراکنش موجود برای عملیات‌های پس از پرداخت
+type TransactionRef struct {
+	Authority   string
+	OrderID     string
+	ReferenceID string
+	Amount      Money
+}
+
+// InquiryResponse نتیجه استعلام تراکنش از درگاه. Status نرمال‌شده است:
+// StatusSuccess یعنی پرداخت انجام شده ولی هنوز تأیید نشده، StatusAlreadyVerified یعنی
+// تأیید (یا تسویه) شده و StatusPending یعنی کاربر هنوز در درگاه است یا نتیجه قطعی نیست.
+// Amount و ReferenceID فقط در صورتی پر می‌شوند که درگاه آن‌ها را برگرداند.
+type InquiryResponse struct {
+	Status       VerificationStatus
+	Amount       Money
+	ReferenceID  string
+	Message      string
+	OriginalData map[string]interface{}
 }
 
 type VerificationStatus int
@@ -50,6 +131,8 @@ const (
 	StatusAmountMismatch
 	StatusCancelled
 	StatusInvalid
+	StatusReversed
+	StatusPending
 )
 
 type VerificationResponse struct {
@@ -58,23 +141,96 @@ type VerificationResponse struct {
 	CardNumber   string
 	Message      string
 	OriginalData map[string]interface{}
+
+	FailedStage Operation       // مرحله‌ای که شکست خورد (OpVerify، OpSettle، ...)؛ خالی در صورت موفقیت
+	Reversal    *ReversalResult // نتیجه برگشت خودکار وجه، اگر درایور آن را انجام داده باشد
+}
+
+// ReversalResult نتیجه برگشت خودکار وجه پس از مغایرت مبلغ یا شکست تسویه
+type ReversalResult struct {
+	Reversed bool
+	Code     string
+	Message  string
 }
 
+// RefundMethod روش واریز وجه بازپرداخت به مشتری
+type RefundMethod string
+
+const (
+	RefundInstant RefundMethod = "instant" // واریز لحظه‌ای به کارت پرداخت‌کننده
+	RefundPAYA    RefundMethod = "paya"    // واریز از طریق پایا در چرخه بعدی
+)
+
+// RefundReason دلیل بازپرداخت که به درگاه گزارش می‌شود
+type RefundReason string
+
+const (
+	RefundReasonCustomerRequest RefundReason = "customer_request"
+	RefundReasonDuplicate       RefundReason = "duplicate_transaction"
+	RefundReasonSuspicious      RefundReason = "suspicious_transaction"
+	RefundReasonOther           RefundReason = "other"
+)
+
+// RefundStatus وضعیت نرمال‌شده درخواست بازپرداخت
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"   // ثبت شده و در انتظار واریز
+	RefundCompleted RefundStatus = "completed" // به حساب مشتری واریز شده
+	RefundFailed    RefundStatus = "failed"
+)
+
+// RefundRequest درخواست بازپرداخت کامل یا جزئی یک تراکنش تسویه‌شده.
+// TransactionRefID شناسه‌ای است که درگاه برای بازپرداخت می‌خواهد (مثلاً session_id
+// زرین‌پال) و اگر خالی باشد درایور آن را از ReferenceID پیدا می‌کند؛ Authority، ReferenceID
+// و Amount در صورت خالی بودن از تراکنش ذخیره‌شده پر می‌شوند.
 type RefundRequest struct {
 	TransactionRefID string
-	Amount           int64
+	Authority        string // برای درگاه‌هایی مثل فن‌آوا که برگشت را با توکن پرداخت انجام می‌دهند
+	ReferenceID      string // شماره مرجع تأیید تراکنش (مثلاً RefNum فن‌آوا)
+	Amount           Money
+	OriginalAmount   Money // مبلغ تراکنش اصلی؛ Client.Refund آن را پر می‌کند
+	Reason           RefundReason
+	Method           RefundMethod // پیش‌فرض RefundInstant
+	Description      string
 }
 
 type RefundResponse struct {
-	IsSuccess bool
+	IsSuccess    bool
+	RefundID     string
+	Amount       Money
+	Method       RefundMethod
+	Status       RefundStatus
+	Message      string
+	RequestedAt  time.Time
+	CompletedAt  time.Time // تا زمان واریز وجه صفر است
+	OriginalData map[string]interface{}
 }
 
+// GatewayError خطای برگشتی از درایورها. Code و RawCode کد خام درگاه هستند (RawCode برای
+// درگاه‌هایی با کد متنی مثل فن‌آوا) و Kind دسته‌بندی نرمال‌شده آن است (مثلاً ErrInsufficientFunds).
 type GatewayError struct {
+	Driver  string
 	Code    int
+	RawCode string
+	Kind    error
 	Message string
 	Err     error
 }
 
 func (e *GatewayError) Error() string {
-	return fmt.Sprintf("gateway error: code=%d, msg='%s', underlying_err=%v", e.Code, e.Message, e.Err)
+	if e.Driver == "" {
+		return fmt.Sprintf("gateway error: code=%d, msg='%s', underlying_err=%v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("gateway error: driver=%s, code=%d, msg='%s', underlying_err=%v", e.Driver, e.Code, e.Message, e.Err)
+}
+
+// Unwrap خطای زیرین را برای errors.Is/As برمی‌گرداند
+func (e *GatewayError) Unwrap() error {
+	return e.Err
+}
+
+// Is خطا را با دسته‌بندی نرمال‌شده آن (Kind) تطبیق می‌دهد
+func (e *GatewayError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
 }
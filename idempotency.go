@@ -0,0 +1,168 @@
+package gopay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyReused کلید تکراری با محتوای متفاوت از درخواست اول
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different payload")
+	// ErrIdempotencyInProgress درخواست دیگری با همین کلید هنوز در حال اجراست
+	ErrIdempotencyInProgress = errors.New("purchase with the same idempotency key is in progress")
+)
+
+// IdempotencyRecord وضعیت ذخیره‌شده یک Purchase برای یک کلید؛ Response تا پایان
+// موفق درخواست اول خالی است.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Response    *PaymentResponse
+	CreatedAt   time.Time
+}
+
+// IdempotencyStore وضعیت حذف تکرار Purchase را به ازای (driver, key) نگه می‌دارد.
+// Reserve باید اتمیک باشد: اگر رکوردی وجود داشته باشد آن را برمی‌گرداند و گرنه
+// رکورد جدیدی با fingerprint داده‌شده می‌سازد و (nil, nil) برمی‌گرداند.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, driver, key, fingerprint string) (*IdempotencyRecord, error)
+	Complete(ctx context.Context, driver, key string, resp *PaymentResponse) error
+	Release(ctx context.Context, driver, key string) error
+}
+
+// WithIdempotencyStore محل نگهداری وضعیت حذف تکرار Purchase را تعیین می‌کند
+// (پیش‌فرض: MemoryIdempotencyStore)
+func WithIdempotencyStore(store IdempotencyStore) Option {
+	return func(c *Client) {
+		c.idempotency = store
+	}
+}
+
+// PurchaseFingerprint اثرانگشت محتوای درخواست است که برای تشخیص استفاده مجدد
+// یک کلید با درخواست متفاوت به کار می‌رود.
+func PurchaseFingerprint(req *TransactionRequest) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatInt(req.Amount.Rials(), 10)))
+	h.Write([]byte{0})
+	h.Write([]byte(req.CallbackURL))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Description))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupPurchase در صورت تکراری بودن درخواست، پاسخ ذخیره‌شده را برمی‌گرداند.
+// اگر هر دو مقدار خالی باشند، درخواست جدید است و کلید برای آن رزرو شده است.
+func (c *Client) dedupPurchase(ctx context.Context, name string, req *TransactionRequest) (*PaymentResponse, error) {
+	record, err := c.idempotency.Reserve(ctx, name, req.IdempotencyKey, PurchaseFingerprint(req))
+	if err != nil || record == nil {
+		return nil, err
+	}
+	if record.Fingerprint != PurchaseFingerprint(req) {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if record.Response == nil {
+		return nil, ErrIdempotencyInProgress
+	}
+	resp := *record.Response
+	return &resp, nil
+}
+
+type memoryIdempotencyKey struct {
+	driver string
+	key    string
+}
+
+// DefaultIdempotencyTTL مدت نگهداری رکوردهای MemoryIdempotencyStore پیش‌فرض Client
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// MemoryIdempotencyStore پیاده‌سازی درون‌حافظه‌ای IdempotencyStore. رکوردها پس از
+// ttl منقضی می‌شوند (حتی اگر درخواست اول هیچ‌وقت Complete نشده باشد) و کلید دوباره
+// قابل استفاده است؛ رکوردهای منقضی هنگام Reserve به صورت دوره‌ای پاک می‌شوند.
+// این Store بین چند پروسه مشترک نیست.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[memoryIdempotencyKey]*IdempotencyRecord
+	ttl       time.Duration
+	now       func() time.Time
+	nextSweep time.Time
+}
+
+var _ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return NewMemoryIdempotencyStoreWithTTL(DefaultIdempotencyTTL)
+}
+
+// NewMemoryIdempotencyStoreWithTTL یک MemoryIdempotencyStore با مدت نگهداری ttl می‌سازد
+func NewMemoryIdempotencyStoreWithTTL(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[memoryIdempotencyKey]*IdempotencyRecord),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, driver, key, fingerprint string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	k := memoryIdempotencyKey{driver: driver, key: key}
+	if record, ok := s.records[k]; ok && !s.expired(record, now) {
+		copied := *record
+		return &copied, nil
+	}
+	s.records[k] = &IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: now}
+	return nil, nil
+}
+
+// Len تعداد رکوردهای نگهداری‌شده (شامل رکوردهای منقضی که هنوز پاک نشده‌اند)
+func (s *MemoryIdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
+
+func (s *MemoryIdempotencyStore) expired(record *IdempotencyRecord, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(record.CreatedAt) >= s.ttl
+}
+
+// sweep حداکثر هر نصف ttl یک بار رکوردهای منقضی را حذف می‌کند
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if s.ttl <= 0 || now.Before(s.nextSweep) {
+		return
+	}
+	for k, record := range s.records {
+		if s.expired(record, now) {
+			delete(s.records, k)
+		}
+	}
+	s.nextSweep = now.Add(s.ttl / 2)
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, driver, key string, resp *PaymentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[memoryIdempotencyKey{driver: driver, key: key}]
+	if !ok {
+		return errors.New("idempotency key '" + key + "' is not reserved")
+	}
+	copied := *resp
+	record.Response = &copied
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, driver, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, memoryIdempotencyKey{driver: driver, key: key})
+	return nil
+}
@@ -0,0 +1,89 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPurchaseReplaysIdempotentRequest(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+
+	req := &TransactionRequest{Amount: Tomans(1000), CallbackURL: "https://shop.test/cb", IdempotencyKey: "order-1"}
+	first, err := c.Purchase(ctx, "zp", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Purchase(ctx, "zp", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Authority != first.Authority {
+		t.Fatalf("replayed authority %q, want %q", second.Authority, first.Authority)
+	}
+	if n := driver.Calls(OpPurchase); n != 1 {
+		t.Fatalf("driver called %d times, want 1", n)
+	}
+
+	changed := *req
+	changed.Amount = Tomans(2000)
+	if _, err := c.Purchase(ctx, "zp", &changed); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("err = %v, want ErrIdempotencyKeyReused", err)
+	}
+}
+
+func TestPurchaseReleasesKeyAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+
+	fail := true
+	driver.purchase = func(context.Context, *TransactionRequest) (*PaymentResponse, error) {
+		if fail {
+			return nil, &GatewayError{Kind: ErrAuthFailed}
+		}
+		return &PaymentResponse{Authority: "A-ok"}, nil
+	}
+
+	req := &TransactionRequest{Amount: Tomans(1000), IdempotencyKey: "order-1"}
+	if _, err := c.Purchase(ctx, "zp", req); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+	fail = false
+	resp, err := c.Purchase(ctx, "zp", req)
+	if err != nil || resp.Authority != "A-ok" {
+		t.Fatalf("retry after failure: resp=%+v err=%v", resp, err)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiresRecords(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryIdempotencyStoreWithTTL(time.Hour)
+	s.now = func() time.Time { return now }
+
+	if record, err := s.Reserve(ctx, "zp", "k1", "f1"); record != nil || err != nil {
+		t.Fatalf("first Reserve = %+v, %v", record, err)
+	}
+	if record, _ := s.Reserve(ctx, "zp", "k1", "f1"); record == nil {
+		t.Fatal("second Reserve within ttl did not return the record")
+	}
+
+	now = now.Add(time.Hour)
+	if record, _ := s.Reserve(ctx, "zp", "k1", "f2"); record != nil {
+		t.Fatalf("expired record was returned: %+v", record)
+	}
+	if _, err := s.Reserve(ctx, "zp", "k2", "f"); err != nil {
+		t.Fatal(err)
+	}
+
+	// k1 دوباره رزرو شده و k2 جدید است؛ رکورد دیگری نباید باقی بماند
+	now = now.Add(2 * time.Hour)
+	s.Reserve(ctx, "zp", "k3", "f")
+	if n := s.Len(); n != 1 {
+		t.Fatalf("store holds %d records after sweep, want 1", n)
+	}
+}
@@ -0,0 +1,244 @@
+package gopay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix پیشوند متغیرهای محیطی برای override کردن پیکربندی درایورها،
+// مثلاً GOPAY_DRIVERS_MELLAT_PASSWORD کلید password درایور mellat را تنظیم می‌کند.
+const EnvPrefix = "GOPAY_DRIVERS_"
+
+type ConfigFormat string
+
+const (
+	FormatYAML ConfigFormat = "yaml"
+	FormatJSON ConfigFormat = "json"
+	FormatTOML ConfigFormat = "toml"
+)
+
+// fileConfig ساختار فایل پیکربندی است:
+//
+//	drivers:
+//	  mellat:
+//	    driver: behpardakht_v1
+//	    terminal_id: 1234
+//	    password: ${MELLAT_PASSWORD}
+type fileConfig struct {
+	Drivers map[string]map[string]interface{} `json:"drivers" toml:"drivers"`
+}
+
+// yamlConfig مقادیر YAML را به صورت Node نگه می‌دارد تا متن خام آن‌ها (مثلاً
+// شماره ترمینال با صفر ابتدایی) بدون تبدیل به عدد خوانده شود
+type yamlConfig struct {
+	Drivers map[string]map[string]yaml.Node `yaml:"drivers"`
+}
+
+// LoadConfig فایل پیکربندی را می‌خواند، ارجاع‌های ${ENV} را جایگزین می‌کند،
+// override های محیطی را اعمال می‌کند و نتیجه را با schema درایورها اعتبارسنجی می‌کند.
+func LoadConfig(path string) (*Config, error) {
+	format, err := formatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	config, err := ParseConfig(data, format)
+	if err != nil {
+		return nil, err
+	}
+	ApplyEnv(config, os.Environ())
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ParseConfig محتوای یک فایل پیکربندی را با فرمت داده‌شده پارس کرده و
+// ارجاع‌های ${ENV} و ${ENV:-default} را از متغیرهای محیطی جایگزین می‌کند.
+// مقادیر YAML و JSON با همان متن فایل نگه داشته می‌شوند؛ مقادیر غیر ساده (لیست،
+// جدول) و اعداد اعشاری TOML که متن اصلی‌شان قابل بازیابی نیست رد می‌شوند.
+func ParseConfig(data []byte, format ConfigFormat) (*Config, error) {
+	drivers, err := decodeDrivers(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s config: %w", format, err)
+	}
+
+	config := &Config{Drivers: make(map[string]DriverConfig, len(drivers))}
+	var errs []error
+	for name, values := range drivers {
+		driverConfig := make(DriverConfig, len(values))
+		for key, value := range values {
+			text, err := scalarText(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("driver '%s' key '%s': %w", name, key, err))
+				continue
+			}
+			expanded, err := expandEnv(text, os.LookupEnv)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("driver '%s' key '%s': %w", name, key, err))
+				continue
+			}
+			driverConfig[key] = expanded
+		}
+		config.Drivers[name] = driverConfig
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func decodeDrivers(data []byte, format ConfigFormat) (map[string]map[string]interface{}, error) {
+	var raw fileConfig
+	switch format {
+	case FormatYAML:
+		var doc yamlConfig
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		drivers := make(map[string]map[string]interface{}, len(doc.Drivers))
+		for name, values := range doc.Drivers {
+			drivers[name] = make(map[string]interface{}, len(values))
+			for key, node := range values {
+				drivers[name][key] = node
+			}
+		}
+		return drivers, nil
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		return raw.Drivers, nil
+	case FormatTOML:
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		return raw.Drivers, nil
+	default:
+		return nil, fmt.Errorf("unsupported config format '%s'", format)
+	}
+}
+
+// scalarText متن یک مقدار ساده پیکربندی را برمی‌گرداند
+func scalarText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case yaml.Node:
+		if v.Kind == yaml.AliasNode && v.Alias != nil {
+			return scalarText(*v.Alias)
+		}
+		if v.Kind != yaml.ScalarNode {
+			return "", errors.New("value must be a scalar")
+		}
+		if v.Tag == "!!null" {
+			return "", nil
+		}
+		return v.Value, nil
+	case float64:
+		return "", errors.New("floating-point values are not supported, quote the value as a string")
+	default:
+		return "", fmt.Errorf("value must be a scalar, got %T", value)
+	}
+}
+
+// ApplyEnv متغیرهای محیطی GOPAY_DRIVERS_<NAME>_<KEY> را روی درایورهای موجود در
+// پیکربندی اعمال می‌کند. نام درایور با طولانی‌ترین تطابق انتخاب می‌شود تا نام‌ها و
+// کلیدهای شامل "_" به درستی از هم جدا شوند.
+func ApplyEnv(config *Config, environ []string) {
+	if config.Drivers == nil {
+		return
+	}
+	names := make([]string, 0, len(config.Drivers))
+	for name := range config.Drivers {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	for _, kv := range environ {
+		envKey, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(envKey, EnvPrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(envKey, EnvPrefix)
+		for _, name := range names {
+			prefix := envName(name) + "_"
+			if strings.HasPrefix(rest, prefix) && len(rest) > len(prefix) {
+				config.Drivers[name][strings.ToLower(rest[len(prefix):])] = value
+				break
+			}
+		}
+	}
+}
+
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv فقط فرم ${VAR} را جایگزین می‌کند تا رمزهای شامل "$" دست‌نخورده بمانند
+func expandEnv(value string, lookup func(string) (string, bool)) (string, error) {
+	var missing []string
+	out := envRef.ReplaceAllStringFunc(value, func(ref string) string {
+		m := envRef.FindStringSubmatch(ref)
+		if v, ok := lookup(m[1]); ok {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		missing = append(missing, m[1])
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable(s) not set: %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func formatFromPath(path string) (ConfigFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("cannot detect config format of '%s'", path)
+	}
+}
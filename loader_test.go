@@ -0,0 +1,117 @@
+package gopay
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigKeepsScalarText(t *testing.T) {
+	tests := map[ConfigFormat]string{
+		FormatYAML: `
+drivers:
+  mellat:
+    driver: fake
+    terminal_id: 0012
+    label: 12345678901234567890
+`,
+		FormatJSON: `{"drivers": {"mellat": {"driver": "fake", "terminal_id": "0012", "label": 12345678901234567890}}}`,
+		FormatTOML: `
+[drivers.mellat]
+driver = "fake"
+terminal_id = "0012"
+label = "12345678901234567890"
+`,
+	}
+	for format, data := range tests {
+		t.Run(string(format), func(t *testing.T) {
+			config, err := ParseConfig([]byte(data), format)
+			if err != nil {
+				t.Fatalf("ParseConfig: %v", err)
+			}
+			got := config.Drivers["mellat"]
+			if got["terminal_id"] != "0012" {
+				t.Errorf("terminal_id = %q, want %q", got["terminal_id"], "0012")
+			}
+			if got["label"] != "12345678901234567890" {
+				t.Errorf("label = %q, want the exact number text", got["label"])
+			}
+		})
+	}
+}
+
+func TestParseConfigRejectsNonScalars(t *testing.T) {
+	tests := map[ConfigFormat]string{
+		FormatYAML: "drivers:\n  mellat:\n    label: [a, b]\n",
+		FormatJSON: `{"drivers": {"mellat": {"label": {"a": 1}}}}`,
+		FormatTOML: "[drivers.mellat]\nlabel = 1.5\n",
+	}
+	for format, data := range tests {
+		t.Run(string(format), func(t *testing.T) {
+			_, err := ParseConfig([]byte(data), format)
+			if err == nil || !strings.Contains(err.Error(), "key 'label'") {
+				t.Fatalf("err = %v, want an error for key 'label'", err)
+			}
+		})
+	}
+}
+
+func TestParseConfigExpandsEnv(t *testing.T) {
+	t.Setenv("GOPAY_TEST_SECRET", "p$ss")
+	config, err := ParseConfig([]byte(`
+drivers:
+  mellat:
+    label: ${GOPAY_TEST_SECRET}
+    terminal_id: ${GOPAY_TEST_UNSET:-42}
+`), FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Drivers["mellat"]["label"]; got != "p$ss" {
+		t.Errorf("label = %q", got)
+	}
+	if got := config.Drivers["mellat"]["terminal_id"]; got != "42" {
+		t.Errorf("terminal_id = %q, want default 42", got)
+	}
+
+	if _, err := ParseConfig([]byte("drivers:\n  mellat:\n    label: ${GOPAY_TEST_UNSET}\n"), FormatYAML); err == nil {
+		t.Fatal("missing environment variable was accepted")
+	}
+}
+
+func TestApplyEnvPicksLongestDriverName(t *testing.T) {
+	config := &Config{Drivers: map[string]DriverConfig{
+		"mellat":      {},
+		"mellat_shop": {},
+	}}
+	ApplyEnv(config, []string{
+		"GOPAY_DRIVERS_MELLAT_SHOP_TERMINAL_ID=7",
+		"GOPAY_DRIVERS_MELLAT_LABEL=main",
+		"OTHER=1",
+	})
+	if got := config.Drivers["mellat_shop"]["terminal_id"]; got != "7" {
+		t.Errorf("mellat_shop terminal_id = %q", got)
+	}
+	if got := config.Drivers["mellat"]["label"]; got != "main" {
+		t.Errorf("mellat label = %q", got)
+	}
+	if _, ok := config.Drivers["mellat"]["shop_terminal_id"]; ok {
+		t.Error("override was applied to the shorter driver name")
+	}
+}
+
+func TestLoadConfigValidatesSchema(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gopay.yaml")
+	if err := os.WriteFile(path, []byte("drivers:\n  main:\n    driver: fake\n    terminal_id: abc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "terminal_id") {
+		t.Fatalf("err = %v, want a terminal_id validation error", err)
+	}
+
+	if _, err := LoadConfig(filepath.Join(dir, "gopay.ini")); err == nil {
+		t.Fatal("unknown extension was accepted")
+	}
+}
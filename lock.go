@@ -0,0 +1,101 @@
+package gopay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Locker قفل انحصاری به ازای کلید؛ Client برای اطمینان از یک‌بار اجرای Verify/Settle
+// به ازای هر تراکنش از آن استفاده می‌کند. برای چند نمونه از سرویس باید یک پیاده‌سازی
+// توزیع‌شده (مثلاً بر پایه Redis یا advisory lock پایگاه‌داده) تزریق شود.
+type Locker interface {
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// WithLocker قفل مورد استفاده در VerifyAndConfirm را تعیین می‌کند (پیش‌فرض: MemoryLocker)
+func WithLocker(locker Locker) Option {
+	return func(c *Client) {
+		c.locker = locker
+	}
+}
+
+type memoryLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// MemoryLocker پیاده‌سازی درون‌پردازه‌ای Locker
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]*memoryLock
+}
+
+var _ Locker = (*MemoryLocker)(nil)
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{locks: make(map[string]*memoryLock)}
+}
+
+func (l *MemoryLocker) Lock(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &memoryLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	select {
+	case lock.ch <- struct{}{}:
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				<-lock.ch
+				l.release(key, lock)
+			})
+		}, nil
+	case <-ctx.Done():
+		l.release(key, lock)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *MemoryLocker) release(key string, lock *memoryLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// lockTransaction قفل‌های Authority و OrderID تراکنش را به همین ترتیب می‌گیرد؛
+// VerifyAndConfirm بسته به درایور یکی از این دو را به عنوان کلید callback قفل می‌کند،
+// پس Reconciler و Refund با گرفتن هر دو با callback هم‌زمان نمی‌شوند
+func (c *Client) lockTransaction(ctx context.Context, tx *Transaction) (func(), error) {
+	var unlocks []func()
+	release := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	keys := []string{tx.Authority}
+	if tx.OrderID != tx.Authority {
+		keys = append(keys, tx.OrderID)
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		unlock, err := c.locker.Lock(ctx, tx.Driver+":"+key)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to acquire transaction lock: %w", err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
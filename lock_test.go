@@ -0,0 +1,125 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryLockerExcludesSameKey(t *testing.T) {
+	l := NewMemoryLocker()
+	unlock, err := l.Lock(context.Background(), "zp:A1")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	// کلید دیگر مستقل است
+	other, err := l.Lock(context.Background(), "zp:A2")
+	if err != nil {
+		t.Fatalf("Lock(other): %v", err)
+	}
+	other()
+
+	// قفل reentrant نیست و کلید گرفته‌شده تا لغو ctx منتظر می‌ماند
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Lock(ctx, "zp:A1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second Lock err = %v, want DeadlineExceeded", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		next, _ := l.Lock(context.Background(), "zp:A1")
+		acquired <- next
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	unlock() // فراخوانی دوباره unlock بی‌اثر است
+	(<-acquired)()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.locks) != 0 {
+		t.Fatalf("released locks still tracked: %v", l.locks)
+	}
+}
+
+func TestVerifyAndConfirmReplaysProcessedCallback(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+	tx := purchaseTx(t, c, "zp")
+	callback := func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/callback?key="+tx.Authority, nil)
+	}
+
+	first, err := c.VerifyAndConfirm(ctx, "zp", callback())
+	if err != nil || first.Status != StatusSuccess {
+		t.Fatalf("first callback = %+v, %v", first, err)
+	}
+	replayed, err := c.VerifyAndConfirm(ctx, "zp", callback())
+	if err != nil || replayed.Status != StatusAlreadyVerified || replayed.ReferenceID != first.ReferenceID {
+		t.Fatalf("replayed callback = %+v, %v", replayed, err)
+	}
+	if n := driver.Calls(OpVerify); n != 1 {
+		t.Fatalf("driver verified %d times, want 1", n)
+	}
+}
+
+func TestVerifyAndConfirmSerializesConcurrentCallbacks(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+	tx := purchaseTx(t, c, "zp")
+
+	release := make(chan struct{})
+	driver.verify = func(ctx context.Context, r *http.Request, fetcher TransactionFetcher) (*VerificationResponse, error) {
+		if _, err := fetcher(ctx, tx.Authority); err != nil {
+			return nil, err
+		}
+		<-release
+		return &VerificationResponse{Status: StatusSuccess, ReferenceID: "R1"}, nil
+	}
+
+	const callbacks = 5
+	var wg sync.WaitGroup
+	statuses := make(chan VerificationStatus, callbacks)
+	for range callbacks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.VerifyAndConfirm(ctx, "zp", httptest.NewRequest(http.MethodGet, "/callback?key="+tx.Authority, nil))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses <- resp.Status
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(statuses)
+
+	success := 0
+	for status := range statuses {
+		switch status {
+		case StatusSuccess:
+			success++
+		case StatusAlreadyVerified:
+		default:
+			t.Errorf("unexpected status %v", status)
+		}
+	}
+	if success != 1 || driver.Calls(OpVerify) != 1 {
+		t.Fatalf("%d successful callbacks and %d driver calls, want 1 each", success, driver.Calls(OpVerify))
+	}
+}
@@ -0,0 +1,195 @@
+package gopay
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+type Lang string
+
+const (
+	LangFa Lang = "fa"
+	LangEn Lang = "en"
+)
+
+// Messages ترجمه‌های یک پیام به تفکیک زبان
+type Messages map[Lang]string
+
+type codeKey struct {
+	driver string
+	code   string
+}
+
+// Catalog پیام‌های دوزبانه خطاها و وضعیت‌ها. پیام‌ها به ترتیب از روی کد خام درگاه
+// (driver, code)، سپس دسته‌بندی نرمال‌شده (Kind) و در نهایت پیام خام خطا انتخاب می‌شوند.
+// برنامه‌ها می‌توانند هر پیام را با Set* بازنویسی کنند.
+type Catalog struct {
+	mu       sync.RWMutex
+	codes    map[codeKey]Messages
+	kinds    map[error]Messages
+	statuses map[VerificationStatus]Messages
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{
+		codes:    make(map[codeKey]Messages),
+		kinds:    make(map[error]Messages),
+		statuses: make(map[VerificationStatus]Messages),
+	}
+}
+
+// DefaultCatalog کاتالوگ سراسری که درایورها پیام‌های خود را در init() در آن ثبت می‌کنند
+var DefaultCatalog = newDefaultCatalog()
+
+// RegisterMessages پیام‌های کدهای خام یک درایور را در DefaultCatalog ثبت می‌کند
+func RegisterMessages(driver string, messages map[string]Messages) {
+	for code, m := range messages {
+		for lang, text := range m {
+			DefaultCatalog.SetCodeMessage(driver, code, lang, text)
+		}
+	}
+}
+
+func (c *Catalog) SetCodeMessage(driver, code string, lang Lang, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	set(c.codes, codeKey{driver: driver, code: code}, lang, text)
+}
+
+func (c *Catalog) SetKindMessage(kind error, lang Lang, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	set(c.kinds, kind, lang, text)
+}
+
+func (c *Catalog) SetStatusMessage(status VerificationStatus, lang Lang, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	set(c.statuses, status, lang, text)
+}
+
+func set[K comparable](m map[K]Messages, key K, lang Lang, text string) {
+	if m[key] == nil {
+		m[key] = make(Messages)
+	}
+	m[key][lang] = text
+}
+
+// CodeMessage پیام ثبت‌شده برای کد خام درایور را برمی‌گرداند
+func (c *Catalog) CodeMessage(driver, code string, lang Lang) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	text, ok := c.codes[codeKey{driver: driver, code: code}][lang]
+	return text, ok
+}
+
+// ErrorMessage پیام محلی‌شده یک خطا را برمی‌گرداند
+func (c *Catalog) ErrorMessage(err error, lang Lang) string {
+	var gatewayErr *GatewayError
+	if errors.As(err, &gatewayErr) {
+		return c.gatewayMessage(gatewayErr, lang)
+	}
+	for kind := range c.kindsSnapshot() {
+		if errors.Is(err, kind) {
+			if text, ok := c.kindMessage(kind, lang); ok {
+				return text
+			}
+		}
+	}
+	return err.Error()
+}
+
+func (c *Catalog) gatewayMessage(e *GatewayError, lang Lang) string {
+	code := e.RawCode
+	if code == "" {
+		code = strconv.Itoa(e.Code)
+	}
+	if text, ok := c.CodeMessage(e.Driver, code, lang); ok {
+		return text
+	}
+	if e.Kind != nil {
+		if text, ok := c.kindMessage(e.Kind, lang); ok {
+			return text
+		}
+	}
+	if e.Message != "" {
+		return e.Message
+	}
+	if lang == LangFa {
+		return fmt.Sprintf("خطای درگاه با کد: %s", code)
+	}
+	return fmt.Sprintf("gateway error with code: %s", code)
+}
+
+func (c *Catalog) kindMessage(kind error, lang Lang) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	text, ok := c.kinds[kind][lang]
+	return text, ok
+}
+
+func (c *Catalog) kindsSnapshot() map[error]struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[error]struct{}, len(c.kinds))
+	for k := range c.kinds {
+		out[k] = struct{}{}
+	}
+	return out
+}
+
+// StatusMessage پیام محلی‌شده یک وضعیت تأیید را برمی‌گرداند
+func (c *Catalog) StatusMessage(status VerificationStatus, lang Lang) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if text, ok := c.statuses[status][lang]; ok {
+		return text
+	}
+	return fmt.Sprintf("status(%d)", int(status))
+}
+
+// Localized پیام خطا را به زبان داده‌شده از DefaultCatalog برمی‌گرداند
+func (e *GatewayError) Localized(lang Lang) string {
+	return DefaultCatalog.gatewayMessage(e, lang)
+}
+
+// Localized پیام وضعیت پاسخ را به زبان داده‌شده از DefaultCatalog برمی‌گرداند
+func (s VerificationStatus) Localized(lang Lang) string {
+	return DefaultCatalog.StatusMessage(s, lang)
+}
+
+func newDefaultCatalog() *Catalog {
+	c := NewCatalog()
+	kinds := map[error]Messages{
+		ErrUserCancelled:      {LangFa: "پرداخت توسط کاربر لغو شد", LangEn: "Payment was cancelled by the user"},
+		ErrInsufficientFunds:  {LangFa: "موجودی حساب کافی نیست", LangEn: "Insufficient funds"},
+		ErrInvalidCard:        {LangFa: "اطلاعات کارت نامعتبر است", LangEn: "Invalid card or card credentials"},
+		ErrDuplicateOrder:     {LangFa: "شماره سفارش تکراری است", LangEn: "Duplicate order"},
+		ErrAuthFailed:         {LangFa: "احراز هویت پذیرنده ناموفق بود", LangEn: "Merchant authentication failed"},
+		ErrIPNotWhitelisted:   {LangFa: "آدرس IP پذیرنده مجاز نیست", LangEn: "Merchant IP address is not whitelisted"},
+		ErrGatewayUnavailable: {LangFa: "درگاه پرداخت در دسترس نیست", LangEn: "Payment gateway is unavailable"},
+		ErrAlreadyVerified:    {LangFa: "تراکنش قبلاً تأیید شده است", LangEn: "Transaction has already been verified"},
+		ErrInvalidAmount:      {LangFa: "مبلغ نامعتبر است", LangEn: "Invalid amount"},
+		ErrAmountMismatch:     {LangFa: "مبلغ پرداختی با مبلغ سفارش مطابقت ندارد", LangEn: "Paid amount does not match the order amount"},
+		ErrInvalidTransaction: {LangFa: "تراکنش نامعتبر است", LangEn: "Invalid or unknown transaction"},
+	}
+	for kind, m := range kinds {
+		c.kinds[kind] = m
+	}
+	statuses := map[VerificationStatus]Messages{
+		StatusFailed:          {LangFa: "پرداخت ناموفق بود", LangEn: "Payment failed"},
+		StatusSuccess:         {LangFa: "پرداخت با موفقیت انجام شد", LangEn: "Payment succeeded"},
+		StatusAlreadyVerified: {LangFa: "پرداخت قبلاً تأیید شده است", LangEn: "Payment has already been verified"},
+		StatusAmountMismatch:  {LangFa: "مبلغ پرداختی با مبلغ سفارش مطابقت ندارد", LangEn: "Paid amount does not match the order amount"},
+		StatusCancelled:       {LangFa: "پرداخت لغو شد", LangEn: "Payment was cancelled"},
+		StatusInvalid:         {LangFa: "اطلاعات بازگشتی از درگاه نامعتبر است", LangEn: "Invalid gateway callback"},
+		StatusReversed:        {LangFa: "مبلغ به حساب پرداخت‌کننده برگشت داده شد", LangEn: "Payment was reversed to the payer"},
+		StatusPending:         {LangFa: "پرداخت هنوز نهایی نشده است", LangEn: "Payment is still pending"},
+	}
+	for status, m := range statuses {
+		c.statuses[status] = m
+	}
+	return c
+}
@@ -0,0 +1,68 @@
+package gopay
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCatalogGatewayMessagePriority(t *testing.T) {
+	c := NewCatalog()
+	c.SetCodeMessage("mellat", "17", LangFa, "کاربر از انجام تراکنش منصرف شده است")
+	c.SetKindMessage(ErrUserCancelled, LangEn, "Payment was cancelled by the user")
+
+	tests := []struct {
+		name string
+		err  *GatewayError
+		lang Lang
+		want string
+	}{
+		{"raw code", &GatewayError{Driver: "mellat", Code: 17, Kind: ErrUserCancelled}, LangFa, "کاربر از انجام تراکنش منصرف شده است"},
+		{"raw code text", &GatewayError{Driver: "mellat", RawCode: "17", Code: 99}, LangFa, "کاربر از انجام تراکنش منصرف شده است"},
+		{"kind", &GatewayError{Driver: "mellat", Code: 17, Kind: ErrUserCancelled}, LangEn, "Payment was cancelled by the user"},
+		{"message", &GatewayError{Driver: "mellat", Code: 5, Message: "raw gateway text"}, LangEn, "raw gateway text"},
+		{"fallback fa", &GatewayError{Driver: "mellat", Code: 5}, LangFa, "خطای درگاه با کد: 5"},
+		{"fallback en", &GatewayError{Driver: "mellat", Code: 5}, LangEn, "gateway error with code: 5"},
+	}
+	for _, tt := range tests {
+		if got := c.ErrorMessage(fmt.Errorf("verify: %w", tt.err), tt.lang); got != tt.want {
+			t.Errorf("%s: ErrorMessage = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogErrorMessageForPlainErrors(t *testing.T) {
+	c := NewCatalog()
+	c.SetKindMessage(ErrInvalidAmount, LangEn, "Invalid amount")
+
+	if got := c.ErrorMessage(fmt.Errorf("refund: %w", ErrInvalidAmount), LangEn); got != "Invalid amount" {
+		t.Errorf("wrapped kind = %q", got)
+	}
+	if got := c.ErrorMessage(errors.New("boom"), LangFa); got != "boom" {
+		t.Errorf("unknown error = %q", got)
+	}
+}
+
+func TestDefaultCatalogCoversKindsAndStatuses(t *testing.T) {
+	kinds := []error{
+		ErrUserCancelled, ErrInsufficientFunds, ErrInvalidCard, ErrDuplicateOrder, ErrAuthFailed,
+		ErrIPNotWhitelisted, ErrGatewayUnavailable, ErrAlreadyVerified, ErrInvalidAmount,
+		ErrAmountMismatch, ErrInvalidTransaction,
+	}
+	for _, kind := range kinds {
+		for _, lang := range []Lang{LangFa, LangEn} {
+			if _, ok := DefaultCatalog.kindMessage(kind, lang); !ok {
+				t.Errorf("no %s message for %v", lang, kind)
+			}
+		}
+	}
+
+	for status := StatusFailed; status <= StatusPending; status++ {
+		if got := status.Localized(LangFa); got == fmt.Sprintf("status(%d)", int(status)) {
+			t.Errorf("no fa message for status %d", status)
+		}
+	}
+	if got := NewCatalog().StatusMessage(StatusSuccess, LangEn); got != "status(1)" {
+		t.Errorf("empty catalog status message = %q", got)
+	}
+}
@@ -2,7 +2,7 @@ package mock
 
 import (
 	"context"
-	"gopay"
+	"github.com/arminmiraftab/GoPay"
 	"net/http"
 )
 
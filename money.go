@@ -0,0 +1,90 @@
+package gopay
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPrecisionLoss زمانی برگردانده می‌شود که تبدیل واحد مبلغ باعث از دست رفتن دقت شود
+// (مثلاً مبلغ ریالی که بر ۱۰ بخش‌پذیر نیست و به درگاه تومانی ارسال می‌شود).
+var ErrPrecisionLoss = errors.New("amount conversion loses precision")
+
+type Unit int
+
+const (
+	Rial Unit = iota
+	Toman
+)
+
+func (u Unit) String() string {
+	switch u {
+	case Rial:
+		return "IRR"
+	case Toman:
+		return "IRT"
+	default:
+		return fmt.Sprintf("unit(%d)", int(u))
+	}
+}
+
+// ParseUnit واحد را از کد ISO آن (IRR یا IRT) می‌خواند
+func ParseUnit(s string) (Unit, error) {
+	switch s {
+	case "IRR":
+		return Rial, nil
+	case "IRT":
+		return Toman, nil
+	default:
+		return 0, fmt.Errorf("unknown amount unit '%s'", s)
+	}
+}
+
+// rialsPer تعداد ریال در هر واحد
+func (u Unit) rialsPer() int64 {
+	if u == Toman {
+		return 10
+	}
+	return 1
+}
+
+// Money مبلغ به همراه واحد آن؛ تمام تبدیل‌های ریال/تومان فقط از طریق متد In انجام می‌شود.
+type Money struct {
+	Amount int64
+	Unit   Unit
+}
+
+func Rials(amount int64) Money  { return Money{Amount: amount, Unit: Rial} }
+func Tomans(amount int64) Money { return Money{Amount: amount, Unit: Toman} }
+
+// In مبلغ را به واحد داده‌شده تبدیل می‌کند و تبدیل‌هایی که دقت را از بین می‌برند رد می‌کند
+func (m Money) In(unit Unit) (int64, error) {
+	rials := m.Amount * m.Unit.rialsPer()
+	per := unit.rialsPer()
+	if rials%per != 0 {
+		return 0, fmt.Errorf("%s to %s: %w", m, unit, ErrPrecisionLoss)
+	}
+	return rials / per, nil
+}
+
+// Rials مبلغ را به ریال برمی‌گرداند؛ این تبدیل هرگز دقت را از بین نمی‌برد
+func (m Money) Rials() int64 {
+	return m.Amount * m.Unit.rialsPer()
+}
+
+// Equal دو مبلغ را مستقل از واحدشان مقایسه می‌کند
+func (m Money) Equal(other Money) bool {
+	return m.Rials() == other.Rials()
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%d %s", m.Amount, m.Unit)
+}
+
+// UnitDeclarer درایورها واحد مبلغی که درگاهشان انتظار دارد را با این متد اعلام می‌کنند
+type UnitDeclarer interface {
+	AmountUnit() Unit
+}
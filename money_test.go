@@ -0,0 +1,52 @@
+package gopay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMoneyIn(t *testing.T) {
+	tests := []struct {
+		money   Money
+		unit    Unit
+		want    int64
+		wantErr error
+	}{
+		{Rials(10000), Rial, 10000, nil},
+		{Rials(10000), Toman, 1000, nil},
+		{Tomans(1000), Rial, 10000, nil},
+		{Tomans(1000), Toman, 1000, nil},
+		{Rials(10005), Toman, 0, ErrPrecisionLoss},
+		{Rials(0), Toman, 0, nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.money.In(tt.unit)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("%s.In(%s) = %d, %v; want %d, %v", tt.money, tt.unit, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMoneyEqualAcrossUnits(t *testing.T) {
+	if !Tomans(1000).Equal(Rials(10000)) {
+		t.Error("1000 IRT != 10000 IRR")
+	}
+	if Tomans(1000).Equal(Rials(1000)) {
+		t.Error("1000 IRT == 1000 IRR")
+	}
+	if got := Tomans(25).Rials(); got != 250 {
+		t.Errorf("Tomans(25).Rials() = %d", got)
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	for _, unit := range []Unit{Rial, Toman} {
+		got, err := ParseUnit(unit.String())
+		if err != nil || got != unit {
+			t.Errorf("ParseUnit(%s) = %v, %v", unit, got, err)
+		}
+	}
+	if _, err := ParseUnit("USD"); err == nil {
+		t.Error("ParseUnit accepted USD")
+	}
+}
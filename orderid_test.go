@@ -0,0 +1,93 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnowflakeIsMonotonicAndUnique(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, _ := NewSnowflakeGenerator(1)
+	b, _ := NewSnowflakeGenerator(2)
+	a.now = func() time.Time { return now }
+	b.now = a.now
+
+	seen := make(map[int64]bool)
+	var last int64
+	for i := 0; i < 3*(snowflakeMaxSequence+1); i++ {
+		if i == snowflakeMaxSequence {
+			// عقب رفتن ساعت نباید شناسه تکراری یا نزولی بسازد
+			now = now.Add(-time.Second)
+		}
+		for _, g := range []*SnowflakeGenerator{a, b} {
+			id, err := g.NextOrderID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[id] {
+				t.Fatalf("duplicate id %d", id)
+			}
+			seen[id] = true
+			if g == a {
+				if id <= last {
+					t.Fatalf("id %d is not greater than %d", id, last)
+				}
+				last = id
+			}
+		}
+	}
+}
+
+func TestNewSnowflakeGeneratorValidatesNodeID(t *testing.T) {
+	for _, node := range []int64{-1, snowflakeMaxNode + 1} {
+		if _, err := NewSnowflakeGenerator(node); err == nil {
+			t.Errorf("node id %d was accepted", node)
+		}
+	}
+}
+
+func TestPurchaseRequiresOrderIDGenerator(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"mellat"})
+	fakeOf(t, c, "mellat").numeric = true
+
+	_, err := c.Purchase(ctx, "mellat", &TransactionRequest{Amount: Rials(1000)})
+	if !errors.Is(err, ErrOrderIDGeneratorRequired) {
+		t.Fatalf("err = %v, want ErrOrderIDGeneratorRequired", err)
+	}
+	// شماره سفارش صریح بدون تولیدکننده هم پذیرفته می‌شود
+	if _, err := c.Purchase(ctx, "mellat", &TransactionRequest{Amount: Rials(1000), OrderID: 77}); err != nil {
+		t.Fatalf("explicit OrderID: %v", err)
+	}
+	// بدون تولیدکننده IdempotencyKey عددی به عنوان شماره سفارش استفاده می‌شود
+	var sent int64
+	fakeOf(t, c, "mellat").purchase = func(_ context.Context, req *TransactionRequest) (*PaymentResponse, error) {
+		sent = req.OrderID
+		return &PaymentResponse{Authority: "A2"}, nil
+	}
+	if _, err := c.Purchase(ctx, "mellat", &TransactionRequest{Amount: Rials(1000), IdempotencyKey: "1002"}); err != nil || sent != 1002 {
+		t.Fatalf("numeric IdempotencyKey: order id %d, %v", sent, err)
+	}
+
+	gen, _ := NewSnowflakeGenerator(3)
+	c = newTestClient(t, []string{"mellat"}, WithOrderIDGenerator(gen))
+	driver := fakeOf(t, c, "mellat")
+	driver.numeric = true
+	var got int64
+	driver.purchase = func(_ context.Context, req *TransactionRequest) (*PaymentResponse, error) {
+		got = req.OrderID
+		return &PaymentResponse{Authority: "A1"}, nil
+	}
+	if _, err := c.Purchase(ctx, "mellat", &TransactionRequest{Amount: Rials(1000), IdempotencyKey: "order-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got == 0 {
+		t.Fatal("generated OrderID was not passed to the driver")
+	}
+	tx, err := c.Store().FindByIdempotencyKey(ctx, "mellat", "order-1")
+	if err != nil || tx.OrderID == "" {
+		t.Fatalf("order id mapping was not stored: tx=%+v err=%v", tx, err)
+	}
+}
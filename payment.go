@@ -0,0 +1,438 @@
+package gopay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Purchase تراکنش را با درایور name ایجاد می‌کند و هر تغییر وضعیت
+// (created → redirected یا failed) را در Store ذخیره می‌کند.
+// درخواست‌های تکراری با IdempotencyKey و محتوای یکسان پاسخ ذخیره‌شده قبلی را
+// برمی‌گردانند و به درگاه ارسال نمی‌شوند؛ کلید یکسان با محتوای متفاوت رد می‌شود.
+func (c *Client) Purchase(ctx context.Context, name string, req *TransactionRequest) (resp *PaymentResponse, err error) {
+	purchaser, err := c.Purchaser(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.IdempotencyKey != "" {
+		stored, err := c.dedupPurchase(ctx, name, req)
+		if err != nil || stored != nil {
+			return stored, err
+		}
+		defer func() {
+			if resp != nil {
+				err = errors.Join(err, c.idempotency.Complete(ctx, name, req.IdempotencyKey, resp))
+			} else {
+				_ = c.idempotency.Release(ctx, name, req.IdempotencyKey)
+			}
+		}()
+	}
+
+	if numeric, ok := purchaser.(NumericOrderIDDriver); ok && numeric.RequiresNumericOrderID() && req.OrderID == 0 {
+		var orderID int64
+		if c.orderIDs != nil {
+			if orderID, err = c.orderIDs.NextOrderID(); err != nil {
+				return nil, fmt.Errorf("failed to generate order id: %w", err)
+			}
+		} else if orderID, err = req.NumericOrderID(); err != nil {
+			// بدون تولیدکننده فقط IdempotencyKey عددی می‌تواند شماره سفارش باشد
+			return nil, fmt.Errorf("driver '%s': %w", name, ErrOrderIDGeneratorRequired)
+		}
+		withOrderID := *req
+		withOrderID.OrderID = orderID
+		req = &withOrderID
+	}
+
+	now := time.Now()
+	tx := &Transaction{
+		Driver:         name,
+		IdempotencyKey: req.IdempotencyKey,
+		Amount:         req.Amount,
+		State:          StateCreated,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if req.OrderID != 0 {
+		tx.OrderID = strconv.FormatInt(req.OrderID, 10)
+	}
+	if err := c.store.Create(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to store transaction: %w", err)
+	}
+
+	err = c.guard(name, func() error {
+		var callErr error
+		resp, callErr = purchaser.Purchase(ctx, req)
+		return callErr
+	})
+	if err != nil {
+		_ = tx.Transition(StateFailed, err.Error())
+		return nil, errors.Join(err, c.saveTransaction(ctx, tx))
+	}
+
+	resp.Driver = name
+	tx.Authority = resp.Authority
+	if resp.OrderID != "" {
+		tx.OrderID = resp.OrderID
+	}
+	tx.SetPayload("purchase", resp)
+	if err := tx.Transition(StateRedirected, ""); err != nil {
+		return resp, err
+	}
+	return resp, c.saveTransaction(ctx, tx)
+}
+
+// errReplayedCallback داخلی است و زمانی از fetcher برگردانده می‌شود که تراکنش قبلاً
+// تأیید شده باشد، تا درایور پیش از تماس با بانک متوقف شود.
+var errReplayedCallback = errors.New("callback already processed")
+
+// VerifyAndConfirm callback درایور name را با TransactionFetcher مبتنی بر Store تأیید
+// می‌کند و وضعیت تراکنش (callback_received → verified → settled یا شاخه‌های
+// failed/cancelled/reversed) را ذخیره می‌کند.
+//
+// پردازش هر تراکنش زیر یک قفل به ازای (driver, key) انجام می‌شود و callback های
+// تکراری یا هم‌زمان پاسخ ثبت‌شده قبلی را (با StatusAlreadyVerified برای پرداخت‌های
+// موفق) دریافت می‌کنند، بدون اینکه دوباره با بانک تماس گرفته شود.
+func (c *Client) VerifyAndConfirm(ctx context.Context, name string, r *http.Request) (*VerificationResponse, error) {
+	verifier, err := c.Verifier(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tx       *Transaction
+		replayed *VerificationResponse
+		unlock   func()
+	)
+	defer func() {
+		if unlock != nil {
+			unlock()
+		}
+	}()
+
+	receive := func(key string) error {
+		if unlock != nil || key == "" {
+			return nil
+		}
+		var err error
+		if unlock, err = c.locker.Lock(ctx, name+":"+key); err != nil {
+			return fmt.Errorf("failed to acquire verification lock: %w", err)
+		}
+
+		found, err := findTransaction(ctx, c.store, name, key)
+		if err != nil {
+			return err
+		}
+		tx = found
+		if replayed = recordedVerification(tx); replayed != nil {
+			return errReplayedCallback
+		}
+		if CanTransition(tx.State, StateCallbackReceived) {
+			_ = tx.Transition(StateCallbackReceived, "")
+			return c.saveTransaction(ctx, tx)
+		}
+		return nil
+	}
+
+	if identifier, ok := verifier.(CallbackIdentifier); ok {
+		err := receive(identifier.CallbackKey(r))
+		if replayed != nil {
+			return replayed, nil
+		}
+		if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+			return nil, err
+		}
+	}
+
+	fetcher := func(ctx context.Context, key string) (*OriginalTransaction, error) {
+		if err := receive(key); err != nil {
+			return nil, err
+		}
+		if tx == nil {
+			return nil, ErrTransactionNotFound
+		}
+		return &OriginalTransaction{Amount: tx.Amount}, nil
+	}
+
+	var resp *VerificationResponse
+	verifyErr := c.guard(name, func() error {
+		var callErr error
+		resp, callErr = verifier.VerifyAndConfirm(ctx, r, fetcher)
+		return callErr
+	})
+	if replayed != nil {
+		return replayed, nil
+	}
+	if tx == nil || errors.Is(verifyErr, ErrCircuitOpen) {
+		// با breaker باز تراکنش در callback_received می‌ماند تا بعداً تأیید شود
+		return resp, verifyErr
+	}
+	return resp, errors.Join(verifyErr, c.recordVerification(ctx, tx, resp, verifyErr))
+}
+
+// Inquire وضعیت تراکنش را از درایور name استعلام می‌کند؛ برای زمانی که callback
+// هرگز به سرور نرسیده است. فراخوانی از breaker درایور عبور می‌کند.
+func (c *Client) Inquire(ctx context.Context, name string, ref *TransactionRef) (*InquiryResponse, error) {
+	inquirer, err := c.Inquirer(name)
+	if err != nil {
+		return nil, err
+	}
+	var resp *InquiryResponse
+	err = c.guard(name, func() error {
+		var callErr error
+		resp, callErr = inquirer.Inquire(ctx, ref)
+		return callErr
+	})
+	return resp, err
+}
+
+// ErrRefundInProgress زمانی برگردانده می‌شود که نتیجه بازپرداخت قبلی تراکنش نامعلوم
+// است (مثلاً پاسخ درگاه گم شده) و بازپرداخت دوباره ممکن است وجه را دو بار برگرداند؛
+// نتیجه باید پس از بررسی در پنل درگاه با ResolveRefund ثبت شود.
+var ErrRefundInProgress = errors.New("a previous refund has an unknown outcome")
+
+// Refund تراکنش ذخیره‌شده با کلید key (Authority، OrderID یا IdempotencyKey) را با
+// درایور name بازپرداخت می‌کند. Amount صفر یعنی بازپرداخت باقیمانده مبلغ تراکنش.
+// Authority و ReferenceID از تراکنش ذخیره‌شده پر می‌شوند؛ TransactionRefID شناسه‌ای
+// است که برخی درگاه‌ها برای بازپرداخت می‌خواهند (مثلاً session_id زرین‌پال) و در صورت
+// خالی بودن، درایور آن را از ReferenceID پیدا می‌کند.
+//
+// هر بازپرداخت در payload "refunds" ثبت می‌شود و مجموع بازپرداخت‌ها از مبلغ تراکنش
+// بیشتر نمی‌شود؛ وقتی مجموع به مبلغ تراکنش برسد تراکنش به refunded می‌رود. درایورهایی
+// که PartialRefunder نیستند فقط بازپرداخت کل مبلغ را می‌پذیرند. بازپرداخت زیر همان
+// قفل‌های VerifyAndConfirm و Reconciler انجام می‌شود.
+//
+// تلاش بازپرداخت پیش از تماس با درگاه ذخیره می‌شود. اگر نتیجه تماس نامعلوم باشد (خطای
+// شبکه یا پایان مهلت) تلاش باقی می‌ماند و Refund های بعدی تا ResolveRefund با
+// ErrRefundInProgress رد می‌شوند.
+func (c *Client) Refund(ctx context.Context, name, key string, req *RefundRequest) (*RefundResponse, error) {
+	refunder, err := c.Refunder(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, unlock, err := c.lockedTransaction(ctx, name, key)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if !CanTransition(tx.State, StateRefunded) {
+		return nil, fmt.Errorf("cannot refund %s transaction: %w", tx.State, ErrInvalidTransition)
+	}
+	if attempt, err := tx.PendingRefund(); err != nil {
+		return nil, err
+	} else if attempt != nil {
+		return nil, fmt.Errorf("refund of %s requested at %s: %w", attempt.Amount, attempt.RequestedAt.Format(time.RFC3339), ErrRefundInProgress)
+	}
+	refunded, err := tx.RefundedAmount()
+	if err != nil {
+		return nil, err
+	}
+	remaining := tx.Amount.Rials() - refunded.Rials()
+
+	refund := *req
+	if refund.Authority == "" {
+		refund.Authority = tx.Authority
+	}
+	if refund.ReferenceID == "" {
+		refund.ReferenceID = tx.ReferenceID
+	}
+	refund.OriginalAmount = tx.Amount
+	if refund.Amount.IsZero() {
+		refund.Amount = Rials(remaining)
+	}
+	if refund.Amount.Rials() <= 0 || refund.Amount.Rials() > remaining {
+		return nil, fmt.Errorf("refund amount %s is out of range, %s of %s is already refunded: %w", refund.Amount, refunded, tx.Amount, ErrInvalidAmount)
+	}
+	if refund.Amount.Rials() < tx.Amount.Rials() {
+		if p, ok := refunder.(PartialRefunder); !ok || !p.SupportsPartialRefund() {
+			return nil, unsupported(name, CapabilityPartialRefund)
+		}
+	}
+
+	tx.SetPayload(refundAttemptPayload, &RefundAttempt{Amount: refund.Amount, Reason: refund.Reason, RequestedAt: time.Now()})
+	if err := c.saveTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	var resp *RefundResponse
+	err = c.guard(name, func() error {
+		var callErr error
+		resp, callErr = refunder.Refund(ctx, &refund)
+		return callErr
+	})
+	if err != nil && refundOutcomeUnknown(err) {
+		// درگاه ممکن است بازپرداخت را ثبت کرده باشد؛ تلاش تا ResolveRefund باقی می‌ماند
+		return resp, err
+	}
+	delete(tx.Payloads, refundAttemptPayload)
+	if err != nil {
+		return resp, errors.Join(err, c.saveTransaction(ctx, tx))
+	}
+	if err := recordRefund(tx, resp, refund.Amount, refund.Reason); err != nil {
+		return resp, err
+	}
+	return resp, c.saveTransaction(ctx, tx)
+}
+
+// ResolveRefund نتیجه بازپرداختی را که Refund برای آن ErrRefundInProgress برگردانده
+// پس از بررسی در پنل درگاه ثبت می‌کند. resp برابر nil یعنی درگاه بازپرداخت را ثبت
+// نکرده است؛ در غیر این صورت resp مانند پاسخ Refund در payload "refunds" ذخیره می‌شود.
+func (c *Client) ResolveRefund(ctx context.Context, name, key string, resp *RefundResponse) error {
+	tx, unlock, err := c.lockedTransaction(ctx, name, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	attempt, err := tx.PendingRefund()
+	if err != nil {
+		return err
+	}
+	if attempt == nil {
+		return fmt.Errorf("transaction '%s' has no refund with an unknown outcome", tx.ID)
+	}
+	delete(tx.Payloads, refundAttemptPayload)
+	if resp != nil {
+		if err := recordRefund(tx, resp, attempt.Amount, attempt.Reason); err != nil {
+			return err
+		}
+	}
+	return c.saveTransaction(ctx, tx)
+}
+
+// lockedTransaction تراکنش با کلید key را زیر قفل تراکنش و پس از خواندن دوباره از Store
+// برمی‌گرداند، چون ممکن است پیش از گرفتن قفل عملیات دیگری آن را تغییر داده باشد
+func (c *Client) lockedTransaction(ctx context.Context, name, key string) (*Transaction, func(), error) {
+	found, err := findTransaction(ctx, c.store, name, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	unlock, err := c.lockTransaction(ctx, found)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := c.store.Get(ctx, found.ID)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return tx, unlock, nil
+}
+
+// recordRefund بازپرداخت را به payload "refunds" اضافه می‌کند و وقتی مجموع بازپرداخت‌ها
+// با amount به مبلغ تراکنش برسد تراکنش را به refunded می‌برد
+func recordRefund(tx *Transaction, resp *RefundResponse, amount Money, reason RefundReason) error {
+	refunds, err := tx.Refunds()
+	if err != nil {
+		return err
+	}
+	refunded, err := tx.RefundedAmount()
+	if err != nil {
+		return err
+	}
+	tx.SetPayload("refunds", append(refunds, resp))
+	if resp.Status != RefundFailed && refunded.Rials()+amount.Rials() >= tx.Amount.Rials() {
+		return tx.Transition(StateRefunded, string(reason))
+	}
+	return nil
+}
+
+// refundOutcomeUnknown خطاهایی که معلوم نیست درگاه پیش از آن‌ها بازپرداخت را ثبت کرده یا نه
+func refundOutcomeUnknown(err error) bool {
+	return IsRetryable(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// recordedVerification پاسخ ثبت‌شده تراکنشی که پردازش callback آن تمام شده را برمی‌گرداند
+func recordedVerification(tx *Transaction) *VerificationResponse {
+	switch tx.State {
+	case StateVerified, StateSettled, StateRefunded, StateReversed, StateReversePending, StateFailed, StateCancelled, StateManualReview:
+	default:
+		return nil
+	}
+	raw, ok := tx.Payloads["verify"]
+	if !ok {
+		return nil
+	}
+	var resp VerificationResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil
+	}
+	if resp.Status == StatusSuccess {
+		resp.Status = StatusAlreadyVerified
+	}
+	return &resp
+}
+
+// recordVerification نتیجه Verify را به وضعیت‌های چرخه پرداخت نگاشت و ذخیره می‌کند.
+// نتیجه نامعلوم (بدون پاسخ یا با خطای قابل تکرار) تراکنش را در callback_received نگه
+// می‌دارد تا Reconciler یا callback تکراری آن را نهایی کند.
+func (c *Client) recordVerification(ctx context.Context, tx *Transaction, resp *VerificationResponse, verifyErr error) error {
+	var path []PaymentState
+	reason := ""
+	if verifyErr != nil {
+		reason = verifyErr.Error()
+	}
+
+	switch {
+	case resp == nil:
+		// نتیجه نامعلوم است؛ در callback_received می‌ماند تا Reconciler یا callback بعدی آن را تعیین کند
+		path = []PaymentState{StateCallbackReceived}
+	case resp.Status == StatusSuccess || resp.Status == StatusAlreadyVerified:
+		path = []PaymentState{StateVerified, StateSettled}
+		tx.ReferenceID = resp.ReferenceID
+		tx.CardNumber = MaskCardNumber(resp.CardNumber)
+	case resp.FailedStage == OpSettle && (resp.Reversal == nil || !resp.Reversal.Reversed):
+		// تأییدشده ولی تسویه‌نشده و برگشت‌نخورده؛ در verified می‌ماند تا Reconciler آن را تسویه کند
+		path = []PaymentState{StateVerified}
+		tx.ReferenceID = resp.ReferenceID
+	case resp.Reversal != nil && resp.Reversal.Reversed:
+		// مثلاً مغایرت مبلغ که درایور وجه آن را خودکار برگشت زده است
+		path = []PaymentState{StateReversed}
+	case resp.Reversal != nil:
+		// وجه برداشت شده ولی برگشت خودکار شکست خورده؛ Reconciler برگشت را تکرار می‌کند
+		path = []PaymentState{StateReversePending}
+		tx.ReferenceID = resp.ReferenceID
+	case resp.Status == StatusCancelled:
+		path = []PaymentState{StateCancelled}
+	case resp.Status == StatusReversed:
+		path = []PaymentState{StateReversed}
+	case IsRetryable(verifyErr):
+		// مثلاً خطای شبکه در Verify؛ پرداخت ممکن است انجام شده باشد و نباید بسته شود
+		path = []PaymentState{StateCallbackReceived}
+	default:
+		path = []PaymentState{StateFailed}
+	}
+	if resp != nil {
+		tx.SetPayload("verify", resp)
+		if reason == "" {
+			reason = resp.Message
+		}
+	}
+
+	if tx.State == path[len(path)-1] {
+		return nil
+	}
+	for _, state := range path {
+		if tx.State == state {
+			continue
+		}
+		if err := tx.Transition(state, reason); err != nil {
+			return err
+		}
+	}
+	return c.saveTransaction(ctx, tx)
+}
+
+func (c *Client) saveTransaction(ctx context.Context, tx *Transaction) error {
+	if err := c.store.Update(ctx, tx); err != nil {
+		return fmt.Errorf("failed to store transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,458 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PendingSource منبع تراکنش‌های نیمه‌تمام برای Reconciler. تراکنش‌هایی با وضعیت
+// PendingStates (مثلاً verified ِ تسویه‌نشده یا reverse_pending) که پیش از before
+// ساخته شده‌اند را به ترتیب شناسه و بعد از cursor برمی‌گرداند؛ next خالی یعنی صفحه
+// دیگری وجود ندارد.
+type PendingSource interface {
+	PendingTransactions(ctx context.Context, before time.Time, cursor string, limit int) (txs []*Transaction, next string, err error)
+}
+
+// Checkpoint آخرین cursor پردازش‌شده را نگه می‌دارد تا Reconciler پس از راه‌اندازی
+// مجدد از همان صفحه ادامه دهد
+type Checkpoint interface {
+	LoadCursor(ctx context.Context) (string, error)
+	SaveCursor(ctx context.Context, cursor string) error
+}
+
+// Clock منبع زمان Reconciler؛ در تست‌ها با ساعت ساختگی جایگزین می‌شود
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ReconcileAction تصمیم سیاست تطبیق برای یک تراکنش
+type ReconcileAction int
+
+const (
+	ActionWait    ReconcileAction = iota // فعلاً کاری انجام نمی‌شود
+	ActionConfirm                        // تأیید و تسویه
+	ActionReverse                        // برگشت وجه به پرداخت‌کننده (یا manual_review برای درایورهای بدون Reverser)
+	ActionFail                           // بستن تراکنش به عنوان ناموفق/لغوشده/برگشتی
+)
+
+func (a ReconcileAction) String() string {
+	switch a {
+	case ActionWait:
+		return "wait"
+	case ActionConfirm:
+		return "confirm"
+	case ActionReverse:
+		return "reverse"
+	case ActionFail:
+		return "fail"
+	default:
+		return fmt.Sprintf("ReconcileAction(%d)", int(a))
+	}
+}
+
+// ReconcilePolicy بر اساس نتیجه استعلام و سن تراکنش تصمیم می‌گیرد. اگر استعلام
+// خطا داده باشد inquiry برابر nil و inquiryErr خطای آن است؛ در این حالت فقط
+// ActionWait و ActionFail معنا دارند.
+type ReconcilePolicy func(tx *Transaction, inquiry *InquiryResponse, inquiryErr error, age time.Duration) ReconcileAction
+
+// DefaultReconcilePolicy پرداخت‌های انجام‌شده را تأیید و تسویه می‌کند، مگر اینکه مبلغ
+// استعلام با مبلغ سفارش نخواند که در این صورت برگشت داده می‌شوند. تراکنش‌هایی که پس
+// از expireAfter هنوز در درگاه نیمه‌کاره‌اند یا استعلام آن‌ها همچنان خطا می‌دهد ناموفق
+// ثبت می‌شوند.
+func DefaultReconcilePolicy(expireAfter time.Duration) ReconcilePolicy {
+	return func(tx *Transaction, inquiry *InquiryResponse, inquiryErr error, age time.Duration) ReconcileAction {
+		if inquiryErr != nil {
+			if age >= expireAfter {
+				return ActionFail
+			}
+			return ActionWait
+		}
+		switch inquiry.Status {
+		case StatusSuccess, StatusAlreadyVerified:
+			if !inquiry.Amount.IsZero() && !inquiry.Amount.Equal(tx.Amount) {
+				return ActionReverse
+			}
+			return ActionConfirm
+		case StatusPending:
+			if age >= expireAfter {
+				return ActionFail
+			}
+			return ActionWait
+		default:
+			return ActionFail
+		}
+	}
+}
+
+// ReconcileEvent رویداد پردازش یک تراکنش توسط Reconciler
+type ReconcileEvent struct {
+	TransactionID string
+	Driver        string
+	Action        ReconcileAction
+	Inquiry       *InquiryResponse
+	From          PaymentState
+	To            PaymentState
+	Err           error
+	At            time.Time
+}
+
+// Reconciler تراکنش‌هایی را که callback آن‌ها هرگز نرسیده (پول کسر شده ولی سفارش
+// تأیید نشده) به صورت دوره‌ای پیدا می‌کند، وضعیت‌شان را از درگاه استعلام می‌کند و
+// طبق Policy تأیید/تسویه یا برگشت می‌دهد.
+//
+// هر تراکنش زیر همان قفل‌های VerifyAndConfirm پردازش می‌شود تا با callback دیرهنگام
+// هم‌زمان نشود. تعداد فراخوانی هم‌زمان هر درگاه به MaxConcurrentPerDriver محدود است
+// و پس از هر صفحه cursor در Checkpoint ذخیره می‌شود. OnEvent به صورت سریال و پس از
+// پایان هر صفحه به ترتیب تراکنش‌های PendingSource فراخوانی می‌شود. زمان رویدادها و
+// تغییر وضعیت‌ها از Clock خوانده می‌شود.
+type Reconciler struct {
+	Client                 *Client
+	Source                 PendingSource
+	Policy                 ReconcilePolicy
+	Checkpoint             Checkpoint
+	Clock                  Clock
+	OnEvent                func(ReconcileEvent)
+	MinAge                 time.Duration // فقط تراکنش‌های قدیمی‌تر از این مدت بررسی می‌شوند
+	Interval               time.Duration
+	BatchSize              int
+	MaxConcurrentPerDriver int
+
+	eventMu sync.Mutex
+}
+
+// NewReconciler یک Reconciler با Store خود Client (در صورت پیاده‌سازی PendingSource)
+// و تنظیمات پیش‌فرض می‌سازد
+func NewReconciler(client *Client) *Reconciler {
+	source, _ := client.store.(PendingSource)
+	return &Reconciler{
+		Client:                 client,
+		Source:                 source,
+		Policy:                 DefaultReconcilePolicy(time.Hour),
+		Clock:                  systemClock{},
+		MinAge:                 15 * time.Minute,
+		Interval:               5 * time.Minute,
+		BatchSize:              100,
+		MaxConcurrentPerDriver: 2,
+	}
+}
+
+// Run تا لغو ctx هر Interval یک دور کامل تطبیق انجام می‌دهد
+func (r *Reconciler) Run(ctx context.Context) error {
+	for {
+		if err := r.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			r.emit(ReconcileEvent{Err: err, At: r.Clock.Now()})
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.Clock.After(r.Interval):
+		}
+	}
+}
+
+// RunOnce یک دور کامل روی تراکنش‌های نیمه‌تمام انجام می‌دهد و از cursor ذخیره‌شده
+// در Checkpoint ادامه می‌دهد. پس از پایان دور cursor پاک می‌شود.
+func (r *Reconciler) RunOnce(ctx context.Context) error {
+	if r.Source == nil {
+		return errors.New("reconciler requires a PendingSource")
+	}
+
+	cursor := ""
+	if r.Checkpoint != nil {
+		var err error
+		if cursor, err = r.Checkpoint.LoadCursor(ctx); err != nil {
+			return fmt.Errorf("failed to load reconcile cursor: %w", err)
+		}
+	}
+
+	before := r.Clock.Now().Add(-r.MinAge)
+	for {
+		txs, next, err := r.Source.PendingTransactions(ctx, before, cursor, r.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list pending transactions: %w", err)
+		}
+		r.processBatch(ctx, txs)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		cursor = next
+		if r.Checkpoint != nil {
+			if err := r.Checkpoint.SaveCursor(ctx, cursor); err != nil {
+				return fmt.Errorf("failed to save reconcile cursor: %w", err)
+			}
+		}
+		if cursor == "" {
+			return nil
+		}
+	}
+}
+
+// processBatch تراکنش‌های هر درگاه را به ترتیب و با حداکثر MaxConcurrentPerDriver
+// worker پردازش می‌کند و رویدادها را پس از پایان صفحه به ترتیب txs منتشر می‌کند
+func (r *Reconciler) processBatch(ctx context.Context, txs []*Transaction) {
+	queues := make(map[string]chan int)
+	for i, tx := range txs {
+		if queues[tx.Driver] == nil {
+			queues[tx.Driver] = make(chan int, len(txs))
+		}
+		queues[tx.Driver] <- i
+	}
+
+	events := make([]*ReconcileEvent, len(txs))
+	workers := max(r.MaxConcurrentPerDriver, 1)
+	var wg sync.WaitGroup
+	for _, queue := range queues {
+		close(queue)
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range queue {
+					if ctx.Err() != nil {
+						return
+					}
+					event := r.reconcile(ctx, txs[i])
+					events[i] = &event
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, event := range events {
+		if event != nil {
+			r.emit(*event)
+		}
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, pending *Transaction) (event ReconcileEvent) {
+	event = ReconcileEvent{TransactionID: pending.ID, Driver: pending.Driver, From: pending.State}
+	defer func() {
+		event.At = r.Clock.Now()
+	}()
+
+	unlock, err := r.Client.lockTransaction(ctx, pending)
+	if err != nil {
+		event.Err = err
+		return event
+	}
+	defer unlock()
+
+	// وضعیت ممکن است پیش از گرفتن قفل با callback تغییر کرده باشد
+	tx, err := r.Client.store.Get(ctx, pending.ID)
+	if err != nil {
+		event.Err = err
+		return event
+	}
+	event.From, event.To = tx.State, tx.State
+	if !tx.State.IsPending() {
+		return event
+	}
+	if tx.State == StateReversePending {
+		// نتیجه پرداخت معلوم است و فقط برگشت وجه باید تکرار شود
+		event.Action = ActionReverse
+		event.Err = r.retryReverse(ctx, tx)
+		event.To = tx.State
+		return event
+	}
+
+	inquiry, inquiryErr := r.Client.Inquire(ctx, tx.Driver, tx.Ref())
+	if inquiryErr != nil {
+		inquiry = nil
+	}
+	event.Inquiry = inquiry
+	event.Action = r.Policy(tx, inquiry, inquiryErr, r.Clock.Now().Sub(tx.CreatedAt))
+
+	event.Err = errors.Join(inquiryErr, r.apply(ctx, tx, inquiry, inquiryErr, event.Action))
+	event.To = tx.State
+	return event
+}
+
+func (r *Reconciler) apply(ctx context.Context, tx *Transaction, inquiry *InquiryResponse, inquiryErr error, action ReconcileAction) error {
+	if inquiry == nil {
+		switch action {
+		case ActionWait:
+			return nil
+		case ActionFail:
+			return r.advance(ctx, tx, "reconciled: inquiry failed: "+inquiryErr.Error(), StateFailed)
+		default:
+			return fmt.Errorf("reconcile action %s requires an inquiry result", action)
+		}
+	}
+
+	tx.SetPayload("inquiry", inquiry)
+	reason := "reconciled: " + inquiry.Status.Localized(LangEn)
+
+	switch action {
+	case ActionConfirm:
+		if inquiry.ReferenceID != "" {
+			tx.ReferenceID = inquiry.ReferenceID
+		}
+		reversal, err := r.confirm(ctx, tx, inquiry, reason)
+		if reversal != nil && reversal.Reversed {
+			return errors.Join(err, r.advance(ctx, tx, reason, StateCallbackReceived, StateReversed))
+		}
+		if reversal != nil {
+			return errors.Join(err, r.advance(ctx, tx, reason, StateCallbackReceived, StateReversePending))
+		}
+		if err != nil {
+			return errors.Join(err, r.Client.saveTransaction(ctx, tx))
+		}
+		return r.advance(ctx, tx, reason, StateCallbackReceived, StateVerified, StateSettled)
+	case ActionReverse:
+		return r.reverse(ctx, tx, reason)
+	case ActionFail:
+		switch inquiry.Status {
+		case StatusCancelled:
+			return r.advance(ctx, tx, reason, StateCancelled)
+		case StatusReversed:
+			return r.advance(ctx, tx, reason, StateCallbackReceived, StateReversed)
+		default:
+			return r.advance(ctx, tx, reason, StateFailed)
+		}
+	default:
+		return r.Client.saveTransaction(ctx, tx)
+	}
+}
+
+// reverse وجه تراکنش را با Reverser درایور برگشت می‌دهد. درایورهایی که Reverser نیستند
+// تراکنش را به manual_review می‌برند تا Reconciler آن را هر دور دوباره امتحان نکند.
+func (r *Reconciler) reverse(ctx context.Context, tx *Transaction, reason string) error {
+	reverser, err := r.Client.Reverser(tx.Driver)
+	if errors.Is(err, ErrUnsupportedOperation) {
+		// برگشت خودکار ممکن نیست؛ تراکنش از چرخه Reconciler خارج و به اپراتور سپرده می‌شود
+		return r.advance(ctx, tx, reason+": driver cannot reverse, manual review required", StateCallbackReceived, StateManualReview)
+	}
+	if err != nil {
+		return errors.Join(err, r.Client.saveTransaction(ctx, tx))
+	}
+	var resp *VerificationResponse
+	err = r.Client.guard(tx.Driver, func() error {
+		var callErr error
+		resp, callErr = reverser.Reverse(ctx, tx.Ref())
+		return callErr
+	})
+	if err != nil {
+		return errors.Join(err, r.Client.saveTransaction(ctx, tx))
+	}
+	tx.SetPayload("reverse", resp)
+	return r.advance(ctx, tx, reason, StateCallbackReceived, StateReversed)
+}
+
+// retryReverse برگشت تراکنش reverse_pending را تکرار می‌کند. اگر درایور استعلام داشته
+// باشد ابتدا بررسی می‌شود که برگشت قبلی (با پاسخ گم‌شده) انجام نشده باشد.
+func (r *Reconciler) retryReverse(ctx context.Context, tx *Transaction) error {
+	if _, err := r.Client.Inquirer(tx.Driver); err == nil {
+		inquiry, err := r.Client.Inquire(ctx, tx.Driver, tx.Ref())
+		if err == nil && inquiry.Status == StatusReversed {
+			tx.SetPayload("inquiry", inquiry)
+			return r.advance(ctx, tx, "reconciled: "+inquiry.Status.Localized(LangEn), StateReversed)
+		}
+	}
+	return r.reverse(ctx, tx, "reconciled: retried reversal")
+}
+
+// confirm پرداخت انجام‌شده را با درایور تأیید (اگر هنوز تأیید نشده) و تسویه می‌کند؛
+// مانند Inquire همه فراخوانی‌های درایور از breaker آن عبور می‌کنند.
+// تراکنش پس از تأیید موفق به verified می‌رود تا شکست تسویه آن را دوباره تأیید نکند.
+// reversal غیر nil یعنی درایور هنگام تأیید (مثلاً به دلیل مغایرت مبلغ) برگشت وجه را
+// انجام داده یا (با Reversed=false) امتحان کرده و شکست خورده است.
+func (r *Reconciler) confirm(ctx context.Context, tx *Transaction, inquiry *InquiryResponse, reason string) (reversal *ReversalResult, err error) {
+	driver, err := r.Client.GetDriver(tx.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	if inquiry.Status == StatusSuccess && tx.State != StateVerified {
+		verifier, ok := driver.(RefVerifier)
+		if !ok {
+			return nil, fmt.Errorf("driver '%s' cannot verify without a callback: %w", tx.Driver, ErrUnsupportedOperation)
+		}
+		var resp *VerificationResponse
+		err := r.Client.guard(tx.Driver, func() error {
+			var callErr error
+			resp, callErr = verifier.Verify(ctx, tx.Ref())
+			return callErr
+		})
+		if resp != nil {
+			tx.SetPayload("verify", resp)
+			if resp.Reversal != nil {
+				if resp.ReferenceID != "" && tx.ReferenceID == "" {
+					tx.ReferenceID = resp.ReferenceID
+				}
+				return resp.Reversal, err
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.Status != StatusSuccess && resp.Status != StatusAlreadyVerified {
+			return nil, fmt.Errorf("verification failed with status %s", resp.Status.Localized(LangEn))
+		}
+		if resp.ReferenceID != "" && tx.ReferenceID == "" {
+			tx.ReferenceID = resp.ReferenceID
+		}
+		if err := r.transition(tx, reason, StateCallbackReceived, StateVerified); err != nil {
+			return nil, err
+		}
+	}
+
+	if settler, ok := driver.(Settler); ok {
+		var resp *VerificationResponse
+		err := r.Client.guard(tx.Driver, func() error {
+			var callErr error
+			resp, callErr = settler.Settle(ctx, tx.Ref())
+			return callErr
+		})
+		if err != nil {
+			return nil, err
+		}
+		tx.SetPayload("settle", resp)
+	}
+	return nil, nil
+}
+
+// advance تراکنش را از مسیر states عبور می‌دهد و ذخیره می‌کند
+func (r *Reconciler) advance(ctx context.Context, tx *Transaction, reason string, states ...PaymentState) error {
+	if err := r.transition(tx, reason, states...); err != nil {
+		return err
+	}
+	return r.Client.saveTransaction(ctx, tx)
+}
+
+// transition تراکنش را با زمان Clock از مسیر states عبور می‌دهد. مراحل میانی که
+// تراکنش از آن‌ها گذشته است (مثلاً callback_received برای تراکنش verified) رد می‌شوند.
+func (r *Reconciler) transition(tx *Transaction, reason string, states ...PaymentState) error {
+	for i, state := range states {
+		if tx.State == state {
+			continue
+		}
+		if i < len(states)-1 && !CanTransition(tx.State, state) {
+			continue
+		}
+		if err := tx.TransitionAt(state, reason, r.Clock.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) emit(event ReconcileEvent) {
+	if r.OnEvent == nil {
+		return
+	}
+	r.eventMu.Lock()
+	defer r.eventMu.Unlock()
+	r.OnEvent(event)
+}
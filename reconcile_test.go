@@ -0,0 +1,255 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestReconciler یک Client با درایورهای fake و یک Reconciler با ساعت ساختگی می‌سازد
+// که دو ساعت پس از زمان فعلی تنظیم شده است
+func newTestReconciler(t *testing.T, names ...string) (*Reconciler, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Now().Add(2 * time.Hour).Truncate(time.Second)}
+	r := NewReconciler(newTestClient(t, names))
+	r.Clock = clock
+	r.Policy = DefaultReconcilePolicy(3 * time.Hour)
+	return r, clock
+}
+
+func TestReconcilerConfirmsPaidTransactionWithClockTimestamps(t *testing.T) {
+	ctx := context.Background()
+	r, clock := newTestReconciler(t, "zp")
+	driver := fakeOf(t, r.Client, "zp")
+	driver.inquire = func(context.Context, *TransactionRef) (*InquiryResponse, error) {
+		return &InquiryResponse{Status: StatusSuccess, Amount: Rials(10000), ReferenceID: "R9"}, nil
+	}
+	tx := purchaseTx(t, r.Client, "zp")
+
+	var events []ReconcileEvent
+	r.OnEvent = func(e ReconcileEvent) { events = append(events, e) }
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := r.Client.Store().Get(ctx, tx.ID)
+	if got.State != StateSettled || got.ReferenceID != "R9" {
+		t.Fatalf("state=%s ref=%q, want settled R9", got.State, got.ReferenceID)
+	}
+	if driver.Calls(OpVerify) != 1 || driver.Calls(OpSettle) != 1 {
+		t.Fatalf("verify=%d settle=%d, want 1 each", driver.Calls(OpVerify), driver.Calls(OpSettle))
+	}
+	for _, change := range got.History[1:] {
+		if !change.At.Equal(clock.now) {
+			t.Fatalf("transition %s->%s at %v, want clock time %v", change.From, change.To, change.At, clock.now)
+		}
+	}
+	if len(events) != 1 || events[0].Action != ActionConfirm || !events[0].At.Equal(clock.now) {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+func TestReconcilerSkipsVerifyForVerifiedTransaction(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestReconciler(t, "mellat")
+	driver := fakeOf(t, r.Client, "mellat")
+	driver.inquire = func(context.Context, *TransactionRef) (*InquiryResponse, error) {
+		return &InquiryResponse{Status: StatusSuccess}, nil
+	}
+	tx := purchaseTx(t, r.Client, "mellat")
+	tx.Transition(StateCallbackReceived, "")
+	tx.Transition(StateVerified, "")
+	r.Client.Store().Update(ctx, tx)
+
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := r.Client.Store().Get(ctx, tx.ID)
+	if got.State != StateSettled || driver.Calls(OpVerify) != 0 {
+		t.Fatalf("state=%s verify calls=%d", got.State, driver.Calls(OpVerify))
+	}
+}
+
+func TestReconcilerExpiresTransactionWhenInquiryKeepsFailing(t *testing.T) {
+	ctx := context.Background()
+	r, clock := newTestReconciler(t, "zp")
+	fakeOf(t, r.Client, "zp").inquire = func(context.Context, *TransactionRef) (*InquiryResponse, error) {
+		return nil, &GatewayError{Kind: ErrGatewayUnavailable, Message: "down"}
+	}
+	tx := purchaseTx(t, r.Client, "zp")
+
+	var events []ReconcileEvent
+	r.OnEvent = func(e ReconcileEvent) { events = append(events, e) }
+	r.RunOnce(ctx)
+	got, _ := r.Client.Store().Get(ctx, tx.ID)
+	if got.State != StateRedirected {
+		t.Fatalf("state = %s before expiry, want redirected", got.State)
+	}
+	if len(events) != 1 || events[0].Action != ActionWait || !errors.Is(events[0].Err, ErrGatewayUnavailable) {
+		t.Fatalf("events = %+v", events)
+	}
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	r.RunOnce(ctx)
+	got, _ = r.Client.Store().Get(ctx, tx.ID)
+	if got.State != StateFailed {
+		t.Fatalf("state = %s after expiry, want failed", got.State)
+	}
+	last := got.History[len(got.History)-1]
+	if !strings.Contains(last.Reason, "inquiry failed") || !last.At.Equal(clock.now) {
+		t.Fatalf("last transition = %+v", last)
+	}
+}
+
+func TestReconcilerEmitsEventsInSourceOrder(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestReconciler(t, "a", "b", "c")
+	r.MaxConcurrentPerDriver = 4
+	for _, name := range []string{"a", "b", "c"} {
+		for range 5 {
+			purchaseTx(t, r.Client, name)
+		}
+	}
+
+	pending, _, err := r.Source.PendingTransactions(ctx, time.Now().Add(time.Hour), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		var got []string
+		r.OnEvent = func(e ReconcileEvent) { got = append(got, e.TransactionID) }
+		if err := r.RunOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(pending) {
+			t.Fatalf("got %d events, want %d", len(got), len(pending))
+		}
+		for i, tx := range pending {
+			if got[i] != tx.ID {
+				t.Fatalf("event %d is %s, want %s", i, got[i], tx.ID)
+			}
+		}
+	}
+}
+
+func TestReconcilerGuardsDriverCalls(t *testing.T) {
+	tests := map[string]struct {
+		amount Money
+		hook   func(d *fakeDriver)
+		op     Operation
+	}{
+		"verify": {Rials(10000), func(d *fakeDriver) {
+			d.verifyRef = func(context.Context, *TransactionRef) (*VerificationResponse, error) { return nil, errUnavailable }
+		}, OpVerify},
+		"reverse": {Rials(9000), func(d *fakeDriver) {
+			d.reverse = func(context.Context, *TransactionRef) (*VerificationResponse, error) { return nil, errUnavailable }
+		}, OpReverse},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			config := testBreakerConfig
+			config.MinCalls, config.WindowSize = 2, 2
+			r := NewReconciler(newTestClient(t, []string{"zp"}, WithBreakerConfig(config)))
+			r.Clock = &fakeClock{now: time.Now().Add(2 * time.Hour)}
+			driver := fakeOf(t, r.Client, "zp")
+			driver.inquire = func(context.Context, *TransactionRef) (*InquiryResponse, error) {
+				return &InquiryResponse{Status: StatusSuccess, Amount: tt.amount}, nil
+			}
+			tt.hook(driver)
+			purchaseTx(t, r.Client, "zp")
+
+			r.RunOnce(ctx)
+			if driver.Calls(tt.op) != 1 {
+				t.Fatalf("%s calls = %d", tt.op, driver.Calls(tt.op))
+			}
+			// استعلام موفق و شکست عملیات بعدی هر دو در پنجره breaker ثبت شده‌اند
+			if h := r.Client.breaker("zp").health("zp"); h.Calls != 2 || h.FailureRate != 0.5 || h.Available {
+				t.Fatalf("breaker health = %+v, want the %s failure recorded", h, tt.op)
+			}
+		})
+	}
+}
+
+// inquireOnlyDriver درایوری که استعلام دارد ولی Reverser نیست (مانند زرین‌پال)
+type inquireOnlyDriver struct{ inquiry *InquiryResponse }
+
+func (d *inquireOnlyDriver) GetName() string { return fakeDriverType }
+
+func (d *inquireOnlyDriver) Inquire(context.Context, *TransactionRef) (*InquiryResponse, error) {
+	return d.inquiry, nil
+}
+
+func TestReconcilerSendsUnreversibleTransactionToManualReview(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestReconciler(t, "zp")
+	tx := purchaseTx(t, r.Client, "zp")
+	r.Client.Swap("zp", &inquireOnlyDriver{inquiry: &InquiryResponse{Status: StatusSuccess, Amount: Rials(9000)}})
+
+	var events []ReconcileEvent
+	r.OnEvent = func(e ReconcileEvent) { events = append(events, e) }
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := r.Client.Store().Get(ctx, tx.ID)
+	if got.State != StateManualReview || got.State.IsPending() || got.State.IsTerminal() {
+		t.Fatalf("state = %s, want manual_review", got.State)
+	}
+	if len(events) != 1 || events[0].Action != ActionReverse || events[0].Err != nil || events[0].To != StateManualReview {
+		t.Fatalf("events = %+v", events)
+	}
+
+	// تراکنش دیگر در دورهای بعدی بررسی نمی‌شود
+	events = nil
+	if err := r.RunOnce(ctx); err != nil || len(events) != 0 {
+		t.Fatalf("second run: %v, events %+v", err, events)
+	}
+}
+
+func TestReconcilerRetriesFailedReversal(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestReconciler(t, "fanava")
+	driver := fakeOf(t, r.Client, "fanava")
+	tx := purchaseTx(t, r.Client, "fanava")
+
+	// مغایرت مبلغ که برگشت خودکار آن در Verify شکست خورده است
+	driver.verify = func(ctx context.Context, req *http.Request, fetcher TransactionFetcher) (*VerificationResponse, error) {
+		if _, err := fetcher(ctx, tx.Authority); err != nil {
+			return nil, err
+		}
+		return &VerificationResponse{Status: StatusAmountMismatch, ReferenceID: "R1", FailedStage: OpVerify, Reversal: &ReversalResult{}}, errUnavailable
+	}
+	callback := httptest.NewRequest(http.MethodGet, "/callback?key="+tx.Authority, nil)
+	r.Client.VerifyAndConfirm(ctx, "fanava", callback)
+	got, _ := r.Client.Store().Get(ctx, tx.ID)
+	if got.State != StateReversePending || !got.State.IsPending() || got.ReferenceID != "R1" {
+		t.Fatalf("state=%s ref=%q, want a pending reverse_pending", got.State, got.ReferenceID)
+	}
+	// callback تکراری پاسخ ثبت‌شده را برمی‌گرداند و دوباره Verify نمی‌کند
+	if resp, err := r.Client.VerifyAndConfirm(ctx, "fanava", callback); err != nil || resp.Status != StatusAmountMismatch || driver.Calls(OpVerify) != 1 {
+		t.Fatalf("replayed callback = %+v, %v; verify calls %d", resp, err, driver.Calls(OpVerify))
+	}
+
+	driver.reverse = func(context.Context, *TransactionRef) (*VerificationResponse, error) { return nil, errUnavailable }
+	r.RunOnce(ctx)
+	if got, _ = r.Client.Store().Get(ctx, tx.ID); got.State != StateReversePending {
+		t.Fatalf("state = %s after a failed retry, want reverse_pending", got.State)
+	}
+
+	driver.reverse = nil
+	var events []ReconcileEvent
+	r.OnEvent = func(e ReconcileEvent) { events = append(events, e) }
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = r.Client.Store().Get(ctx, tx.ID); got.State != StateReversed {
+		t.Fatalf("state = %s, want reversed", got.State)
+	}
+	if driver.Calls(OpReverse) != 2 || len(events) != 1 || events[0].Action != ActionReverse || events[0].Err != nil {
+		t.Fatalf("reverse calls %d, events %+v", driver.Calls(OpReverse), events)
+	}
+}
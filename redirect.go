@@ -0,0 +1,83 @@
+package gopay
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+const (
+	RedirectGET  = "GET"
+	RedirectPOST = "POST"
+)
+
+var redirectFormTemplate = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Redirecting to payment gateway</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+{{- range .Params}}
+<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{- end}}
+<noscript><button type="submit">ادامه / Continue</button></noscript>
+</form>
+</body>
+</html>
+`))
+
+type formParam struct {
+	Name  string
+	Value string
+}
+
+// WriteRedirect کاربر را به درگاه هدایت می‌کند: برای درگاه‌های GET یک 302 و برای
+// درگاه‌های POST یک فرم HTML با escape کامل که به صورت خودکار submit می‌شود.
+func WriteRedirect(w http.ResponseWriter, r *http.Request, resp *PaymentResponse) error {
+	if resp == nil || resp.PaymentURL == "" {
+		return fmt.Errorf("payment response has no PaymentURL")
+	}
+	target, err := url.Parse(resp.PaymentURL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") {
+		return fmt.Errorf("invalid PaymentURL '%s'", resp.PaymentURL)
+	}
+
+	switch resp.RedirectMethod {
+	case "", RedirectGET:
+		if len(resp.RedirectParams) > 0 {
+			q := target.Query()
+			for k, v := range resp.RedirectParams {
+				q.Set(k, v)
+			}
+			target.RawQuery = q.Encode()
+		}
+		http.Redirect(w, r, target.String(), http.StatusFound)
+		return nil
+	case RedirectPOST:
+		params := make([]formParam, 0, len(resp.RedirectParams))
+		for k, v := range resp.RedirectParams {
+			params = append(params, formParam{Name: k, Value: v})
+		}
+		sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		return redirectFormTemplate.Execute(w, struct {
+			Action string
+			Params []formParam
+		}{Action: target.String(), Params: params})
+	default:
+		return fmt.Errorf("unsupported redirect method '%s'", resp.RedirectMethod)
+	}
+}
+
+// RedirectHandler یک http.Handler برای هدایت کاربر بر اساس PaymentResponse می‌سازد
+func RedirectHandler(resp *PaymentResponse) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := WriteRedirect(w, r, resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package gopay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWriteRedirectGET(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := WriteRedirect(w, httptest.NewRequest(http.MethodGet, "/pay", nil), &PaymentResponse{
+		PaymentURL:     "https://gateway.test/start?lang=fa",
+		RedirectParams: map[string]string{"token": "a&b=c"},
+	})
+	if err != nil {
+		t.Fatalf("WriteRedirect: %v", err)
+	}
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want 302", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Location: %v", err)
+	}
+	if q := location.Query(); q.Get("token") != "a&b=c" || q.Get("lang") != "fa" {
+		t.Fatalf("Location = %s", location)
+	}
+}
+
+func TestWriteRedirectPOSTEscapesParams(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := WriteRedirect(w, httptest.NewRequest(http.MethodGet, "/pay", nil), &PaymentResponse{
+		PaymentURL:     "https://gateway.test/start",
+		RedirectMethod: RedirectPOST,
+		RedirectParams: map[string]string{
+			"RefId":  `"><script>alert(1)</script>`,
+			"Mobile": "09120000000",
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteRedirect: %v", err)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "<script>alert") {
+		t.Fatalf("param value was not escaped:\n%s", body)
+	}
+	if !strings.Contains(body, `action="https://gateway.test/start"`) || !strings.Contains(body, `name="RefId" value="&#34;&gt;&lt;script&gt;`) {
+		t.Fatalf("unexpected form:\n%s", body)
+	}
+	if strings.Index(body, `name="Mobile"`) > strings.Index(body, `name="RefId"`) {
+		t.Fatal("form params are not sorted")
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatal("form response is cacheable")
+	}
+}
+
+func TestWriteRedirectRejectsInvalidResponses(t *testing.T) {
+	tests := map[string]*PaymentResponse{
+		"nil":        nil,
+		"empty url":  {},
+		"javascript": {PaymentURL: "javascript:alert(1)"},
+		"method":     {PaymentURL: "https://gateway.test", RedirectMethod: "PUT"},
+	}
+	for name, resp := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := WriteRedirect(w, httptest.NewRequest(http.MethodGet, "/pay", nil), resp); err == nil {
+				t.Fatal("WriteRedirect accepted an invalid response")
+			}
+			if w.Body.Len() != 0 {
+				t.Fatalf("invalid response wrote a body: %s", w.Body)
+			}
+		})
+	}
+}
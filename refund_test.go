@@ -0,0 +1,174 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// settledTx یک تراکنش تسویه‌شده برای درایور name در Store ِ c ثبت می‌کند
+func settledTx(t *testing.T, c *Client, name string) *Transaction {
+	t.Helper()
+	now := time.Now()
+	tx := &Transaction{
+		Driver:      name,
+		Authority:   "A1",
+		OrderID:     "1001",
+		ReferenceID: "R1",
+		Amount:      Rials(10000),
+		State:       StateSettled,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := c.Store().Create(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestRefundTracksCumulativeAmount(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+	driver.partial = true
+	var last RefundRequest
+	driver.refund = func(_ context.Context, req *RefundRequest) (*RefundResponse, error) {
+		last = *req
+		return &RefundResponse{IsSuccess: true, Amount: req.Amount, Status: RefundCompleted}, nil
+	}
+	tx := settledTx(t, c, "zp")
+
+	if _, err := c.Refund(ctx, "zp", "A1", &RefundRequest{Amount: Rials(6000), TransactionRefID: "S1"}); err != nil {
+		t.Fatal(err)
+	}
+	if last.TransactionRefID != "S1" || last.ReferenceID != "R1" || last.Authority != "A1" || !last.OriginalAmount.Equal(Rials(10000)) {
+		t.Fatalf("driver got %+v", last)
+	}
+	if _, err := c.Refund(ctx, "zp", "A1", &RefundRequest{Amount: Rials(5000)}); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("over-refund: err = %v, want ErrInvalidAmount", err)
+	}
+	if n := driver.Calls(OpRefund); n != 1 {
+		t.Fatalf("driver called %d times, want 1", n)
+	}
+
+	// Amount صفر یعنی باقیمانده مبلغ
+	if _, err := c.Refund(ctx, "zp", "A1", &RefundRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if !last.Amount.Equal(Rials(4000)) {
+		t.Fatalf("second refund amount = %s, want the remaining 4000 rial", last.Amount)
+	}
+
+	got, _ := c.Store().Get(ctx, tx.ID)
+	refunded, _ := got.RefundedAmount()
+	refunds, _ := got.Refunds()
+	if got.State != StateRefunded || !refunded.Equal(got.Amount) || len(refunds) != 2 {
+		t.Fatalf("state=%s refunded=%s refunds=%d", got.State, refunded, len(refunds))
+	}
+}
+
+func TestRefundIgnoresFailedRefundsInTotal(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+	driver.refund = func(_ context.Context, req *RefundRequest) (*RefundResponse, error) {
+		return &RefundResponse{Amount: req.Amount, Status: RefundFailed}, nil
+	}
+	tx := settledTx(t, c, "zp")
+
+	c.Refund(ctx, "zp", "A1", &RefundRequest{})
+	got, _ := c.Store().Get(ctx, tx.ID)
+	if refunded, _ := got.RefundedAmount(); !refunded.IsZero() || got.State != StateSettled {
+		t.Fatalf("failed refund counted: refunded=%s state=%s", refunded, got.State)
+	}
+}
+
+func TestRefundRejectsPartialWithoutPartialRefunder(t *testing.T) {
+	c := newTestClient(t, []string{"zp"})
+	settledTx(t, c, "zp")
+	_, err := c.Refund(context.Background(), "zp", "A1", &RefundRequest{Amount: Rials(100)})
+	if !errors.Is(err, ErrUnsupportedOperation) {
+		t.Fatalf("err = %v, want ErrUnsupportedOperation", err)
+	}
+}
+
+func TestRefundWaitsForCallbackLockOnOrderID(t *testing.T) {
+	c := newTestClient(t, []string{"mellat"})
+	settledTx(t, c, "mellat")
+
+	// callback ملت با SaleOrderId قفل می‌شود
+	unlock, err := c.locker.Lock(context.Background(), "mellat:1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Refund(ctx, "mellat", "1001", &RefundRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the refund to wait for the order lock", err)
+	}
+	if n := fakeOf(t, c, "mellat").Calls(OpRefund); n != 0 {
+		t.Fatalf("driver called %d times while the callback held the lock", n)
+	}
+}
+
+func TestRefundRecordsAttemptBeforeCallingGateway(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+	tx := settledTx(t, c, "zp")
+	driver.refund = func(context.Context, *RefundRequest) (*RefundResponse, error) {
+		// تلاش پیش از تماس با درگاه ذخیره شده است
+		stored, _ := c.Store().Get(ctx, tx.ID)
+		if attempt, err := stored.PendingRefund(); err != nil || attempt == nil || !attempt.Amount.Equal(Rials(10000)) {
+			t.Errorf("attempt during the call = %+v, %v", attempt, err)
+		}
+		return nil, errUnavailable
+	}
+
+	if _, err := c.Refund(ctx, "zp", "A1", &RefundRequest{}); !errors.Is(err, ErrGatewayUnavailable) {
+		t.Fatalf("err = %v", err)
+	}
+	// پاسخ گم شده؛ بازپرداخت دوباره تا ثبت نتیجه رد می‌شود
+	if _, err := c.Refund(ctx, "zp", "A1", &RefundRequest{}); !errors.Is(err, ErrRefundInProgress) {
+		t.Fatalf("retry err = %v, want ErrRefundInProgress", err)
+	}
+	if n := driver.Calls(OpRefund); n != 1 {
+		t.Fatalf("driver called %d times, want 1", n)
+	}
+
+	if err := c.ResolveRefund(ctx, "zp", "A1", &RefundResponse{IsSuccess: true, RefundID: "F9", Amount: Rials(10000), Status: RefundCompleted}); err != nil {
+		t.Fatalf("ResolveRefund: %v", err)
+	}
+	got, _ := c.Store().Get(ctx, tx.ID)
+	if attempt, _ := got.PendingRefund(); attempt != nil || got.State != StateRefunded {
+		t.Fatalf("after resolve: state=%s attempt=%+v", got.State, attempt)
+	}
+	if err := c.ResolveRefund(ctx, "zp", "A1", nil); err == nil {
+		t.Fatal("ResolveRefund accepted a transaction without a pending refund")
+	}
+}
+
+func TestRefundClearsAttemptOnDefiniteFailure(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	driver := fakeOf(t, c, "zp")
+	driver.refund = func(context.Context, *RefundRequest) (*RefundResponse, error) {
+		return &RefundResponse{Status: RefundFailed}, &GatewayError{Kind: ErrAuthFailed}
+	}
+	tx := settledTx(t, c, "zp")
+
+	if _, err := c.Refund(ctx, "zp", "A1", &RefundRequest{}); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("err = %v", err)
+	}
+	got, _ := c.Store().Get(ctx, tx.ID)
+	if attempt, _ := got.PendingRefund(); attempt != nil {
+		t.Fatalf("rejected refund left an attempt: %+v", attempt)
+	}
+	driver.refund = nil
+	if _, err := c.Refund(ctx, "zp", "A1", &RefundRequest{}); err != nil {
+		t.Fatalf("refund after a rejected attempt: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package gopay
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// InitializerFunc یک نمونه جدید از درایور را بر اساس پیکربندی آن می‌سازد
+type InitializerFunc func(config DriverConfig) (Driver, error)
+
+type registration struct {
+	initializer InitializerFunc
+	schema      ConfigSchema
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register یک نوع درایور را همراه با schema پیکربندی آن در رجیستری سراسری ثبت می‌کند.
+// هر پکیج درایور باید این تابع را در init() خود فراخوانی کند (مشابه database/sql).
+// ثبت تکراری یا initializer خالی باعث panic می‌شود.
+func Register(driverType string, initializer InitializerFunc, schema ConfigSchema) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if initializer == nil {
+		panic("gopay: Register initializer is nil")
+	}
+	if _, dup := registry[driverType]; dup {
+		panic("gopay: Register called twice for driver " + driverType)
+	}
+	registry[driverType] = registration{initializer: initializer, schema: schema}
+}
+
+// Drivers فهرست مرتب‌شده نوع درایورهای ثبت‌شده را برمی‌گرداند
+func Drivers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	list := make([]string, 0, len(registry))
+	for name := range registry {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Schema پیکربندی مورد انتظار یک نوع درایور را برای ابزارها و مستندسازی برمی‌گرداند
+func Schema(driverType string) (ConfigSchema, error) {
+	reg, err := lookup(driverType)
+	if err != nil {
+		return nil, err
+	}
+	return reg.schema, nil
+}
+
+func lookup(driverType string) (registration, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	reg, ok := registry[driverType]
+	if !ok {
+		return registration{}, fmt.Errorf("unknown driver type '%s' (forgotten import?)", driverType)
+	}
+	return reg, nil
+}
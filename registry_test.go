@@ -0,0 +1,70 @@
+package gopay
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegisterPanics(t *testing.T) {
+	initializer := func(DriverConfig) (Driver, error) { return &fakeDriver{calls: make(map[Operation]int)}, nil }
+
+	for name, register := range map[string]func(){
+		"duplicate": func() { Register(fakeDriverType, initializer, nil) },
+		"nil":       func() { Register("fake-nil", nil, nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Register did not panic")
+				}
+			}()
+			register()
+		})
+	}
+	if slices.Contains(Drivers(), "fake-nil") {
+		t.Fatal("nil initializer was registered")
+	}
+}
+
+func TestDriversAndSchema(t *testing.T) {
+	drivers := Drivers()
+	if !slices.IsSorted(drivers) || !slices.Contains(drivers, fakeDriverType) {
+		t.Fatalf("Drivers() = %v", drivers)
+	}
+
+	schema, err := Schema(fakeDriverType)
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	if _, ok := schema.Field("terminal_id"); !ok {
+		t.Fatalf("fake schema = %v", schema)
+	}
+	if _, err := Schema("missing"); err == nil || !strings.Contains(err.Error(), "forgotten import") {
+		t.Fatalf("Schema(missing) err = %v", err)
+	}
+}
+
+func TestGetDriverCachesPerName(t *testing.T) {
+	c := newTestClient(t, []string{"primary", "backup"})
+
+	first, second := fakeOf(t, c, "primary"), fakeOf(t, c, "primary")
+	if first != second {
+		t.Fatal("GetDriver built a second instance for the same name")
+	}
+	if fakeOf(t, c, "backup") == first {
+		t.Fatal("two names of the same type share one instance")
+	}
+	if _, err := c.GetDriver("missing"); err == nil {
+		t.Fatal("GetDriver accepted an unconfigured name")
+	}
+}
+
+func TestNewClientRejectsUnknownType(t *testing.T) {
+	_, err := NewClient(&Config{Drivers: map[string]DriverConfig{
+		"zp": {DriverTypeKey: "missing"},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "driver 'zp'") {
+		t.Fatalf("NewClient err = %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package gopay
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+)
+
+// Reload پیکربندی جدید را اعتبارسنجی کرده و به صورت اتمیک جایگزین پیکربندی فعلی می‌کند.
+// نمونه درایورهایی که پیکربندی‌شان تغییر کرده (یا حذف شده‌اند) از cache خارج می‌شوند و
+// در اولین GetDriver بعدی با پیکربندی جدید ساخته می‌شوند. فراخوانی‌های در جریان
+// (Purchase/VerifyAndConfirm) که نمونه قبلی را در دست دارند تا پایان با همان نمونه ادامه می‌دهند.
+func (c *Client) Reload(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("reload rejected: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name := range c.drivers {
+		newConfig, ok := config.Drivers[name]
+		if !ok || !maps.Equal(newConfig, c.config.Drivers[name]) {
+			delete(c.drivers, name)
+		}
+	}
+	c.config = config
+	return nil
+}
+
+// Swap نمونه درایور name را به صورت اتمیک با driver جایگزین می‌کند (مثلاً پس از
+// چرخش رمز ترمینال). name باید در پیکربندی فعلی تعریف شده باشد و سیاست تکرار
+// Client مانند درایورهای ساخته‌شده با GetDriver روی driver اعمال می‌شود.
+func (c *Client) Swap(name string, driver Driver) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.config.Drivers[name]; !ok {
+		return fmt.Errorf("config for driver '%s' not found", name)
+	}
+	c.prepare(driver)
+	c.drivers[name] = driver
+	return nil
+}
+
+// WatchConfig فایل پیکربندی را هر interval بررسی می‌کند و در صورت تغییر زمان ویرایش آن،
+// با LoadConfig بارگذاری و Reload می‌کند. خطاها به onError داده می‌شوند و پیکربندی
+// فعلی دست‌نخورده باقی می‌ماند. تا لغو ctx ادامه می‌دهد.
+func (c *Client) WatchConfig(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			onError(fmt.Errorf("failed to stat config file: %w", err))
+			continue
+		}
+		if !info.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		config, err := LoadConfig(path)
+		if err != nil {
+			onError(err)
+			continue
+		}
+		if err := c.Reload(config); err != nil {
+			onError(err)
+		}
+	}
+}
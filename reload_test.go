@@ -0,0 +1,145 @@
+package gopay
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadReplacesOnlyChangedDrivers(t *testing.T) {
+	c := newTestClient(t, []string{"kept", "changed", "removed"})
+	kept, changed := fakeOf(t, c, "kept"), fakeOf(t, c, "changed")
+	fakeOf(t, c, "removed")
+
+	err := c.Reload(&Config{Drivers: map[string]DriverConfig{
+		"kept":    {DriverTypeKey: fakeDriverType},
+		"changed": {DriverTypeKey: fakeDriverType, "label": "rotated"},
+	}})
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if fakeOf(t, c, "kept") != kept {
+		t.Error("unchanged driver was rebuilt")
+	}
+	if fakeOf(t, c, "changed") == changed {
+		t.Error("changed driver kept its old instance")
+	}
+	if _, err := c.GetDriver("removed"); err == nil {
+		t.Error("removed driver is still available")
+	}
+	// نمونه قبلی که در دست فراخوانی‌های در جریان است همچنان قابل استفاده است
+	if _, err := changed.Purchase(context.Background(), &TransactionRequest{}); err != nil {
+		t.Errorf("old instance Purchase: %v", err)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	c := newTestClient(t, []string{"zp"})
+	before := fakeOf(t, c, "zp")
+
+	err := c.Reload(&Config{Drivers: map[string]DriverConfig{
+		"zp": {DriverTypeKey: fakeDriverType, "terminal_id": "abc"},
+	}})
+	if err == nil {
+		t.Fatal("Reload accepted an invalid config")
+	}
+	if fakeOf(t, c, "zp") != before {
+		t.Fatal("rejected reload replaced the driver")
+	}
+}
+
+func TestSwap(t *testing.T) {
+	c := newTestClient(t, []string{"zp"})
+	replacement := &fakeDriver{calls: make(map[Operation]int)}
+
+	if err := c.Swap("zp", replacement); err != nil {
+		t.Fatalf("Swap: %v", err)
+	}
+	if fakeOf(t, c, "zp") != replacement {
+		t.Fatal("GetDriver did not return the swapped instance")
+	}
+	if err := c.Swap("missing", replacement); err == nil {
+		t.Fatal("Swap accepted an unconfigured name")
+	}
+}
+
+// retryingDriver درایور fake که سیاست تکرار دریافتی را نگه می‌دارد
+type retryingDriver struct {
+	*fakeDriver
+	policy RetryPolicy
+}
+
+func (d *retryingDriver) SetRetryPolicy(policy RetryPolicy) { d.policy = policy }
+
+func TestSwapAppliesRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond}
+	c := newTestClient(t, []string{"zp"}, WithRetryPolicy(policy))
+	replacement := &retryingDriver{fakeDriver: &fakeDriver{calls: make(map[Operation]int)}}
+
+	if err := c.Swap("zp", replacement); err != nil {
+		t.Fatalf("Swap: %v", err)
+	}
+	if replacement.policy != policy {
+		t.Fatalf("swapped driver policy = %+v, want %+v", replacement.policy, policy)
+	}
+}
+
+func TestWatchConfigReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gopay.json")
+	write := func(data string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`{"drivers": {"zp": {"driver": "fake", "label": "v1"}}}`, start)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	before := fakeOf(t, c, "zp")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 10)
+	go c.WatchConfig(ctx, path, 5*time.Millisecond, func(err error) { errs <- err })
+
+	// watcher زمان ویرایش اولیه را در goroutine خود می‌خواند؛ تا گزارش خطا زمان ویرایش را جلو می‌بریم
+	deadline := time.Now().Add(2 * time.Second)
+	for mod := start.Add(time.Minute); ; mod = mod.Add(time.Minute) {
+		write(`{"drivers": {"zp": {"driver": "fake", "terminal_id": "oops"}}}`, mod)
+		select {
+		case <-errs:
+		case <-time.After(20 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatal("invalid config was not reported")
+			}
+			continue
+		}
+		break
+	}
+	if fakeOf(t, c, "zp") != before {
+		t.Fatal("invalid config replaced the driver")
+	}
+
+	write(`{"drivers": {"zp": {"driver": "fake", "label": "v2"}}}`, start.Add(24*time.Hour))
+	deadline = time.Now().Add(2 * time.Second)
+	for fakeOf(t, c, "zp") == before {
+		if time.Now().After(deadline) {
+			t.Fatal("config change was not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,134 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// Operation عملیات‌های درایور که ایمن بودن تکرار آن‌ها جداگانه تعیین می‌شود
+type Operation string
+
+const (
+	OpPurchase Operation = "purchase"
+	OpVerify   Operation = "verify"
+	OpSettle   Operation = "settle"
+	OpReverse  Operation = "reverse"
+	OpRefund   Operation = "refund"
+	OpInquiry  Operation = "inquiry"
+)
+
+// RetrySafety درایورها اعلام می‌کنند کدام عملیات در سمت درگاه idempotent است و
+// می‌توان آن را پس از خطای گذرا دوباره ارسال کرد (مثلاً Verify و Settle در ملت).
+type RetrySafety interface {
+	IsRetrySafe(op Operation) bool
+}
+
+// RetryConfigurable درایورهایی که سیاست تکرار Client را برای فراخوانی‌های ایمن خود می‌پذیرند
+type RetryConfigurable interface {
+	SetRetryPolicy(policy RetryPolicy)
+}
+
+// RetryPolicy سیاست تکرار با backoff نمایی و jitter. مقدار صفر آن یعنی بدون تکرار.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64 // نسبت تصادفی‌سازی backoff، بین ۰ و ۱
+}
+
+// DefaultRetryPolicy سیاست پیش‌فرض Client برای عملیات ایمن
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithRetryPolicy سیاست تکرار را برای درایورهای RetryConfigurable تعیین می‌کند
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// Retryable بیان می‌کند که خطا گذرا است و تکرار همان درخواست ممکن است موفق شود
+func (e *GatewayError) Retryable() bool {
+	if errors.Is(e.Kind, ErrGatewayUnavailable) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// IsRetryable بررسی می‌کند که خطا (یا یکی از خطاهای زیرین آن) قابل تکرار است
+func IsRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return false
+}
+
+// Do تابع fn را تا MaxAttempts بار و فقط برای خطاهای قابل تکرار اجرا می‌کند.
+// اگر فاصله تا تلاش بعدی از deadline ِ ctx فراتر برود، آخرین خطا بدون انتظار برگردانده می‌شود.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	backoff := p.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil || !IsRetryable(err) || attempt >= attempts {
+			return err
+		}
+
+		wait := p.jittered(backoff)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff = p.next(backoff)
+	}
+}
+
+// Retry fn را در صورتی با سیاست داده‌شده تکرار می‌کند که عملیات op برای درایور ایمن باشد
+func Retry(ctx context.Context, policy RetryPolicy, safety RetrySafety, op Operation, fn func(ctx context.Context) error) error {
+	if safety == nil || !safety.IsRetrySafe(op) {
+		return fn(ctx)
+	}
+	return policy.Do(ctx, fn)
+}
+
+func (p RetryPolicy) next(backoff time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff = time.Duration(float64(backoff) * multiplier)
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+func (p RetryPolicy) jittered(backoff time.Duration) time.Duration {
+	if p.Jitter <= 0 || backoff <= 0 {
+		return backoff
+	}
+	delta := float64(backoff) * p.Jitter
+	return time.Duration(float64(backoff) - delta + rand.Float64()*2*delta)
+}
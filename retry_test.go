@@ -0,0 +1,65 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestIsRetryable(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"gateway unavailable": {&GatewayError{Kind: ErrGatewayUnavailable}, true},
+		"wrapped unavailable": {fmt.Errorf("verify: %w", &GatewayError{Kind: ErrGatewayUnavailable}), true},
+		"network timeout":     {&GatewayError{Err: timeoutError{}}, true},
+		"auth failure":        {&GatewayError{Kind: ErrAuthFailed}, false},
+		"plain error":         {errors.New("boom"), false},
+	}
+	for name, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable = %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+type safety map[Operation]bool
+
+func (s safety) IsRetrySafe(op Operation) bool { return s[op] }
+
+func TestRetryOnlyRepeatsSafeOperations(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	transient := &GatewayError{Kind: ErrGatewayUnavailable}
+
+	for op, want := range map[Operation]int{OpVerify: 3, OpPurchase: 1} {
+		calls := 0
+		err := Retry(context.Background(), policy, safety{OpVerify: true}, op, func(context.Context) error {
+			calls++
+			return transient
+		})
+		if !errors.Is(err, ErrGatewayUnavailable) || calls != want {
+			t.Errorf("%s: calls = %d err = %v, want %d calls", op, calls, err, want)
+		}
+	}
+
+	calls := 0
+	Retry(context.Background(), policy, safety{OpVerify: true}, OpVerify, func(context.Context) error {
+		calls++
+		return &GatewayError{Kind: ErrAuthFailed}
+	})
+	if calls != 1 {
+		t.Fatalf("permanent error was retried %d times", calls)
+	}
+}
@@ -0,0 +1,247 @@
+package gopay
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+)
+
+// ErrNoRoute زمانی برگردانده می‌شود که هیچ مسیری با مبلغ درخواست سازگار نباشد
+var ErrNoRoute = errors.New("no gateway route matches the request")
+
+// Route یکی از درایورهای Client که Router می‌تواند پرداخت را به آن بفرستد.
+// MinAmount و MaxAmount (در صورت غیر صفر بودن) بازه مبلغ مجاز این مسیر هستند و
+// FixedFee و FeeRate کارمزد هر تراکنش را برای LowestFeeStrategy تعیین می‌کنند.
+type Route struct {
+	Driver    string
+	Weight    int
+	Priority  int // عدد کمتر یعنی اولویت بالاتر
+	MinAmount Money
+	MaxAmount Money
+	FixedFee  Money
+	FeeRate   float64 // کسری از مبلغ، مثلاً 0.002 برای دو در هزار
+}
+
+// Fee کارمزد این مسیر برای مبلغ amount به ریال
+func (r Route) Fee(amount Money) int64 {
+	return r.FixedFee.Rials() + int64(float64(amount.Rials())*r.FeeRate)
+}
+
+// accepts بررسی می‌کند که مبلغ در بازه مجاز مسیر باشد
+func (r Route) accepts(amount Money) bool {
+	if !r.MinAmount.IsZero() && amount.Rials() < r.MinAmount.Rials() {
+		return false
+	}
+	if !r.MaxAmount.IsZero() && amount.Rials() > r.MaxAmount.Rials() {
+		return false
+	}
+	return true
+}
+
+// RouteStrategy ترتیب امتحان مسیرهای سازگار با مبلغ را تعیین می‌کند؛
+// Router به ترتیب برگردانده‌شده مسیرها را امتحان می‌کند و در صورت در دسترس نبودن
+// درگاه به مسیر بعدی می‌رود.
+type RouteStrategy interface {
+	Order(amount Money, routes []Route) []Route
+}
+
+// PriorityStrategy مسیرها را به ترتیب Priority امتحان می‌کند
+type PriorityStrategy struct{}
+
+func (PriorityStrategy) Order(_ Money, routes []Route) []Route {
+	slices.SortStableFunc(routes, func(a, b Route) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+	return routes
+}
+
+// WeightedStrategy ترافیک را به نسبت Weight بین مسیرها پخش می‌کند؛ مسیرهای
+// باقی‌مانده (به همان روش وزنی) برای failover پشت سر مسیر انتخاب‌شده قرار می‌گیرند.
+type WeightedStrategy struct{}
+
+func (WeightedStrategy) Order(_ Money, routes []Route) []Route {
+	ordered := make([]Route, 0, len(routes))
+	for len(routes) > 0 {
+		total := 0
+		for _, route := range routes {
+			total += max(route.Weight, 0)
+		}
+		pick := 0
+		if total > 0 {
+			n := rand.IntN(total)
+			for i, route := range routes {
+				if n -= max(route.Weight, 0); n < 0 {
+					pick = i
+					break
+				}
+			}
+		}
+		ordered = append(ordered, routes[pick])
+		routes = slices.Delete(routes, pick, pick+1)
+	}
+	return ordered
+}
+
+// LowestFeeStrategy ارزان‌ترین مسیر برای مبلغ درخواست را اول امتحان می‌کند و
+// در کارمزد برابر، Priority را ملاک قرار می‌دهد
+type LowestFeeStrategy struct{}
+
+func (LowestFeeStrategy) Order(amount Money, routes []Route) []Route {
+	slices.SortStableFunc(routes, func(a, b Route) int {
+		return cmp.Or(cmp.Compare(a.Fee(amount), b.Fee(amount)), cmp.Compare(a.Priority, b.Priority))
+	})
+	return routes
+}
+
+// Router یک RedirectPayer مرکب از چند درایور Client است. Purchase مسیر را با
+// Strategy انتخاب می‌کند، درگاه‌هایی را که breaker آن‌ها باز است رد می‌کند و در
+// صورت در دسترس نبودن درگاه به مسیر بعدی می‌رود. درایور صادرکننده هر Authority
+// همراه تراکنش در Store ثبت می‌شود و VerifyAndConfirm به همان درایور فرستاده می‌شود.
+type Router struct {
+	client   *Client
+	strategy RouteStrategy
+	routes   []Route
+}
+
+var _ RedirectPayer = (*Router)(nil)
+
+// NewRouter مسیرها را بررسی می‌کند؛ هر Route.Driver باید نام یک درایور
+// RedirectPayer در پیکربندی client باشد.
+func NewRouter(client *Client, strategy RouteStrategy, routes ...Route) (*Router, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("router requires at least one route")
+	}
+	if strategy == nil {
+		strategy = PriorityStrategy{}
+	}
+	for _, route := range routes {
+		if _, err := client.RedirectPayer(route.Driver); err != nil {
+			return nil, fmt.Errorf("invalid route: %w", err)
+		}
+	}
+	return &Router{client: client, strategy: strategy, routes: slices.Clone(routes)}, nil
+}
+
+func (r *Router) GetName() string {
+	return "router"
+}
+
+// Purchase پرداخت را با Client.Purchase روی اولین مسیر در دسترس ایجاد می‌کند.
+// درخواست تکراری با IdempotencyKey به درایوری که بار اول انتخاب شده بود فرستاده
+// می‌شود تا پاسخ ذخیره‌شده آن برگردد. خطاهای تجاری (مثل مبلغ نامعتبر) باعث
+// failover نمی‌شوند.
+func (r *Router) Purchase(ctx context.Context, req *TransactionRequest) (*PaymentResponse, error) {
+	if req.IdempotencyKey != "" {
+		if name, err := r.issuer(ctx, func(driver string) (*Transaction, error) {
+			tx, err := r.client.store.FindByIdempotencyKey(ctx, driver, req.IdempotencyKey)
+			if err == nil && tx.State == StateFailed {
+				// تلاش ناموفق قبلی مانع failover به درگاه دیگر نمی‌شود
+				return nil, ErrTransactionNotFound
+			}
+			return tx, err
+		}); err == nil {
+			return r.client.Purchase(ctx, name, req)
+		} else if !errors.Is(err, ErrTransactionNotFound) {
+			return nil, err
+		}
+	}
+
+	candidates := r.Candidates(req.Amount)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: amount %s", ErrNoRoute, req.Amount)
+	}
+
+	var errs []error
+	for _, route := range candidates {
+		if r.client.breaker(route.Driver).State() == BreakerOpen {
+			errs = append(errs, fmt.Errorf("driver '%s' is unavailable: %w", route.Driver, ErrCircuitOpen))
+			continue
+		}
+		resp, err := r.client.Purchase(ctx, route.Driver, req)
+		if err == nil {
+			return resp, nil
+		}
+		if !errors.Is(err, ErrCircuitOpen) && !IsRetryable(err) {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("all gateway routes failed: %w", errors.Join(errs...))
+}
+
+// Candidates مسیرهای سازگار با amount را به ترتیب Strategy برمی‌گرداند
+func (r *Router) Candidates(amount Money) []Route {
+	var matched []Route
+	for _, route := range r.routes {
+		if route.accepts(amount) {
+			matched = append(matched, route)
+		}
+	}
+	return r.strategy.Order(amount, matched)
+}
+
+// VerifyAndConfirm درایور صادرکننده تراکنش را از روی callback پیدا می‌کند و
+// تأیید را با Client.VerifyAndConfirm به همان درایور می‌سپارد. fetcher استفاده
+// نمی‌شود چون تراکنش از Store خود Client خوانده می‌شود.
+func (r *Router) VerifyAndConfirm(ctx context.Context, req *http.Request, _ TransactionFetcher) (*VerificationResponse, error) {
+	name, err := r.Resolve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return r.client.VerifyAndConfirm(ctx, name, req)
+}
+
+// Resolve نام درایوری را که تراکنش callback را صادر کرده برمی‌گرداند. کلید callback
+// با CallbackKey هر درایور مسیر خوانده و در Store جستجو می‌شود.
+func (r *Router) Resolve(ctx context.Context, req *http.Request) (string, error) {
+	keys := make(map[string]string, len(r.routes))
+	for _, route := range r.routes {
+		driver, err := r.client.GetDriver(route.Driver)
+		if err != nil {
+			return "", err
+		}
+		if identifier, ok := driver.(CallbackIdentifier); ok {
+			keys[route.Driver] = identifier.CallbackKey(req)
+		}
+	}
+
+	name, err := r.issuer(ctx, func(driver string) (*Transaction, error) {
+		if keys[driver] == "" {
+			return nil, ErrTransactionNotFound
+		}
+		return findTransaction(ctx, r.client.store, driver, keys[driver])
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve callback driver: %w", err)
+	}
+	return name, nil
+}
+
+// issuer درایوری از مسیرها را برمی‌گرداند که find برای آن تراکنشی پیدا کند؛
+// در صورت یافتن چند تراکنش، جدیدترین ملاک است
+func (r *Router) issuer(ctx context.Context, find func(driver string) (*Transaction, error)) (string, error) {
+	var found *Transaction
+	for _, route := range r.routes {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		tx, err := find(route.Driver)
+		if errors.Is(err, ErrTransactionNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if found == nil || tx.CreatedAt.After(found.CreatedAt) {
+			found = tx
+		}
+	}
+	if found == nil {
+		return "", ErrTransactionNotFound
+	}
+	return found.Driver, nil
+}
@@ -0,0 +1,160 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func routeNames(routes []Route) []string {
+	names := make([]string, len(routes))
+	for i, route := range routes {
+		names[i] = route.Driver
+	}
+	return names
+}
+
+func TestRouterCandidates(t *testing.T) {
+	c := newTestClient(t, []string{"small", "large", "any"})
+	routes := []Route{
+		{Driver: "any", Priority: 3, FeeRate: 0.01},
+		{Driver: "large", Priority: 2, MinAmount: Tomans(100000), FixedFee: Rials(500)},
+		{Driver: "small", Priority: 1, MaxAmount: Tomans(100000), FixedFee: Rials(5000)},
+	}
+
+	tests := []struct {
+		strategy RouteStrategy
+		amount   Money
+		want     []string
+	}{
+		{PriorityStrategy{}, Tomans(1000), []string{"small", "any"}},
+		{PriorityStrategy{}, Tomans(500000), []string{"large", "any"}},
+		{LowestFeeStrategy{}, Rials(10000), []string{"any", "small"}},
+		{LowestFeeStrategy{}, Tomans(100000), []string{"large", "small", "any"}},
+	}
+	for _, tt := range tests {
+		r, err := NewRouter(c, tt.strategy, routes...)
+		if err != nil {
+			t.Fatalf("NewRouter: %v", err)
+		}
+		if got := routeNames(r.Candidates(tt.amount)); !slices.Equal(got, tt.want) {
+			t.Errorf("%T %s: candidates %v, want %v", tt.strategy, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestWeightedStrategySkipsZeroWeightFirst(t *testing.T) {
+	for range 20 {
+		got := WeightedStrategy{}.Order(Rials(1), []Route{{Driver: "off"}, {Driver: "on", Weight: 1}})
+		if !slices.Equal(routeNames(got), []string{"on", "off"}) {
+			t.Fatalf("order = %v", routeNames(got))
+		}
+	}
+}
+
+func TestNewRouterValidatesRoutes(t *testing.T) {
+	c := newTestClient(t, []string{"zp"})
+	if _, err := NewRouter(c, nil); err == nil {
+		t.Error("NewRouter accepted no routes")
+	}
+	if _, err := NewRouter(c, nil, Route{Driver: "missing"}); err == nil {
+		t.Error("NewRouter accepted an unknown driver")
+	}
+}
+
+func TestRouterFailsOverOnUnavailableGateway(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"primary", "backup"})
+	fakeOf(t, c, "primary").purchase = func(context.Context, *TransactionRequest) (*PaymentResponse, error) {
+		return nil, &GatewayError{Kind: ErrGatewayUnavailable}
+	}
+	r, err := NewRouter(c, nil, Route{Driver: "primary", Priority: 1}, Route{Driver: "backup", Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := r.Purchase(ctx, &TransactionRequest{Amount: Rials(10000), IdempotencyKey: "k1"})
+	if err != nil || resp.Driver != "backup" {
+		t.Fatalf("Purchase = %+v, %v; want the backup driver", resp, err)
+	}
+
+	// درخواست تکراری به درایوری که بار اول انتخاب شد می‌رود
+	replayed, err := r.Purchase(ctx, &TransactionRequest{Amount: Rials(10000), IdempotencyKey: "k1"})
+	if err != nil || replayed.Driver != "backup" || replayed.Authority != resp.Authority {
+		t.Fatalf("replayed Purchase = %+v, %v", replayed, err)
+	}
+	if n := fakeOf(t, c, "primary").Calls(OpPurchase); n != 1 {
+		t.Fatalf("primary called %d times, want 1", n)
+	}
+}
+
+func TestRouterStopsOnBusinessError(t *testing.T) {
+	c := newTestClient(t, []string{"primary", "backup"})
+	fakeOf(t, c, "primary").purchase = func(context.Context, *TransactionRequest) (*PaymentResponse, error) {
+		return nil, &GatewayError{Kind: ErrInvalidAmount}
+	}
+	r, _ := NewRouter(c, nil, Route{Driver: "primary", Priority: 1}, Route{Driver: "backup", Priority: 2})
+
+	_, err := r.Purchase(context.Background(), &TransactionRequest{Amount: Rials(10000)})
+	if !errors.Is(err, ErrInvalidAmount) || fakeOf(t, c, "backup").Calls(OpPurchase) != 0 {
+		t.Fatalf("err = %v, backup called %d times", err, fakeOf(t, c, "backup").Calls(OpPurchase))
+	}
+}
+
+func TestRouterSkipsOpenBreakers(t *testing.T) {
+	config := DefaultBreakerConfig
+	config.MinCalls, config.WindowSize = 1, 1
+	c := newTestClient(t, []string{"primary", "backup"}, WithBreakerConfig(config))
+	c.breaker("primary").Execute(func() error { return errUnavailable })
+	r, _ := NewRouter(c, nil, Route{Driver: "primary", Priority: 1}, Route{Driver: "backup", Priority: 2, MaxAmount: Rials(5000)})
+
+	resp, err := r.Purchase(context.Background(), &TransactionRequest{Amount: Rials(1000)})
+	if err != nil || resp.Driver != "backup" || fakeOf(t, c, "primary").Calls(OpPurchase) != 0 {
+		t.Fatalf("Purchase = %+v, %v", resp, err)
+	}
+
+	_, err = r.Purchase(context.Background(), &TransactionRequest{Amount: Rials(10000)})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen when every route is unavailable", err)
+	}
+
+	only, _ := NewRouter(c, nil, Route{Driver: "backup", MaxAmount: Rials(5000)})
+	if _, err := only.Purchase(context.Background(), &TransactionRequest{Amount: Rials(10000)}); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("err = %v, want ErrNoRoute", err)
+	}
+}
+
+func TestRouterVerifiesWithIssuingDriver(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"primary", "backup"})
+	r, _ := NewRouter(c, nil, Route{Driver: "primary", Priority: 1}, Route{Driver: "backup", Priority: 2})
+
+	// هر دو درایور Authority یکسان A1 صادر می‌کنند؛ جدیدترین تراکنش ملاک است
+	older := purchaseTx(t, c, "primary")
+	older.CreatedAt = older.CreatedAt.Add(-time.Hour)
+	if err := c.Store().Update(ctx, older); err != nil {
+		t.Fatal(err)
+	}
+	fakeOf(t, c, "primary").purchase = func(context.Context, *TransactionRequest) (*PaymentResponse, error) {
+		return nil, &GatewayError{Kind: ErrGatewayUnavailable}
+	}
+	resp, err := r.Purchase(ctx, &TransactionRequest{Amount: Rials(10000)})
+	if err != nil || resp.Driver != "backup" || resp.Authority != "A1" {
+		t.Fatalf("Purchase = %+v, %v", resp, err)
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, "/callback?key=A1", nil)
+	if name, err := r.Resolve(ctx, callback); err != nil || name != "backup" {
+		t.Fatalf("Resolve = %q, %v", name, err)
+	}
+	if _, err := r.VerifyAndConfirm(ctx, callback, nil); err != nil {
+		t.Fatalf("VerifyAndConfirm: %v", err)
+	}
+	if fakeOf(t, c, "backup").Calls(OpVerify) != 1 || fakeOf(t, c, "primary").Calls(OpVerify) != 0 {
+		t.Fatal("callback was not verified by the issuing driver")
+	}
+}
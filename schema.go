@@ -0,0 +1,169 @@
+package gopay
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldInt
+	FieldBool
+	FieldDuration
+	FieldURL
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldString:
+		return "string"
+	case FieldInt:
+		return "int"
+	case FieldBool:
+		return "bool"
+	case FieldDuration:
+		return "duration"
+	case FieldURL:
+		return "url"
+	default:
+		return fmt.Sprintf("field_type(%d)", int(t))
+	}
+}
+
+// ConfigField یک کلید از پیکربندی درایور را توصیف می‌کند
+type ConfigField struct {
+	Key         string
+	Type        FieldType
+	Required    bool
+	Default     string
+	Secret      bool // مقدار آن نباید در لاگ یا خروجی ابزارها چاپ شود
+	Description string
+}
+
+// ConfigSchema کلیدهای مجاز پیکربندی یک نوع درایور است
+type ConfigSchema []ConfigField
+
+// Field تعریف کلید داده‌شده را برمی‌گرداند
+func (s ConfigSchema) Field(key string) (ConfigField, bool) {
+	for _, f := range s {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return ConfigField{}, false
+}
+
+// Validate تمام مشکلات پیکربندی را با هم برمی‌گرداند (نه فقط اولین خطا)
+func (s ConfigSchema) Validate(config DriverConfig) error {
+	var errs []error
+	for _, f := range s {
+		value, ok := config[f.Key]
+		if !ok || value == "" {
+			if f.Required {
+				errs = append(errs, fmt.Errorf("missing required key '%s'", f.Key))
+			}
+			continue
+		}
+		if err := f.Type.parse(value); err != nil {
+			errs = append(errs, fmt.Errorf("key '%s' must be a valid %s: %w", f.Key, f.Type, err))
+		}
+	}
+
+	unknown := make([]string, 0)
+	for key := range config {
+		if key == DriverTypeKey {
+			continue
+		}
+		if _, ok := s.Field(key); !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("unknown key '%s'", key))
+	}
+	return errors.Join(errs...)
+}
+
+// WithDefaults یک کپی از پیکربندی با مقادیر پیش‌فرض کلیدهای تنظیم‌نشده برمی‌گرداند
+func (s ConfigSchema) WithDefaults(config DriverConfig) DriverConfig {
+	out := make(DriverConfig, len(config)+len(s))
+	for k, v := range config {
+		out[k] = v
+	}
+	for _, f := range s {
+		if _, ok := out[f.Key]; !ok && f.Default != "" {
+			out[f.Key] = f.Default
+		}
+	}
+	return out
+}
+
+// Template یک پیکربندی نمونه برای تولید مستندات و فایل‌های قالب می‌سازد؛
+// کلیدهای بدون پیش‌فرض با نوع آن‌ها به صورت <type> پر می‌شوند.
+func (s ConfigSchema) Template() DriverConfig {
+	out := make(DriverConfig, len(s))
+	for _, f := range s {
+		if f.Default != "" {
+			out[f.Key] = f.Default
+		} else {
+			out[f.Key] = "<" + f.Type.String() + ">"
+		}
+	}
+	return out
+}
+
+func (t FieldType) parse(value string) error {
+	var err error
+	switch t {
+	case FieldInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case FieldBool:
+		_, err = strconv.ParseBool(value)
+	case FieldDuration:
+		_, err = time.ParseDuration(value)
+	case FieldURL:
+		var u *url.URL
+		u, err = url.Parse(value)
+		if err == nil && (u.Scheme == "" || u.Host == "") {
+			err = errors.New("absolute url expected")
+		}
+	}
+	return err
+}
+
+// Redacted یک کپی از پیکربندی برمی‌گرداند که مقادیر کلیدهای Secret آن پوشانده شده‌اند
+func (s ConfigSchema) Redacted(config DriverConfig) DriverConfig {
+	out := make(DriverConfig, len(config))
+	for k, v := range config {
+		if f, ok := s.Field(k); ok && f.Secret {
+			v = "******"
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func (c DriverConfig) Int64(key string) (int64, error) {
+	return strconv.ParseInt(c[key], 10, 64)
+}
+
+func (c DriverConfig) Bool(key string) (bool, error) {
+	if c[key] == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(c[key])
+}
+
+func (c DriverConfig) Duration(key string) (time.Duration, error) {
+	if c[key] == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c[key])
+}
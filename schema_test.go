@@ -0,0 +1,100 @@
+package gopay
+
+import (
+	"strings"
+	"testing"
+)
+
+var testSchema = ConfigSchema{
+	{Key: "merchant_id", Type: FieldString, Required: true, Secret: true},
+	{Key: "terminal_id", Type: FieldInt},
+	{Key: "sandbox", Type: FieldBool, Default: "false"},
+	{Key: "timeout", Type: FieldDuration, Default: "30s"},
+	{Key: "callback_url", Type: FieldURL},
+}
+
+func TestSchemaValidateCollectsAllErrors(t *testing.T) {
+	err := testSchema.Validate(DriverConfig{
+		DriverTypeKey:  "zarinpal",
+		"terminal_id":  "12a",
+		"timeout":      "soon",
+		"callback_url": "/callback",
+		"zeta":         "1",
+		"alpha":        "1",
+	})
+	if err == nil {
+		t.Fatal("Validate accepted an invalid config")
+	}
+
+	want := []string{
+		"missing required key 'merchant_id'",
+		"key 'terminal_id' must be a valid int",
+		"key 'timeout' must be a valid duration",
+		"key 'callback_url' must be a valid url",
+		"unknown key 'alpha'",
+		"unknown key 'zeta'",
+	}
+	got := unwrapJoined(err)
+	if len(got) != len(want) {
+		t.Fatalf("Validate returned %d errors, want %d:\n%v", len(got), len(want), err)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(got[i].Error(), w) {
+			t.Errorf("error %d = %q, want prefix %q", i, got[i], w)
+		}
+	}
+}
+
+func TestSchemaValidateAcceptsValidConfig(t *testing.T) {
+	err := testSchema.Validate(DriverConfig{
+		"merchant_id":  "m-1",
+		"terminal_id":  "42",
+		"sandbox":      "true",
+		"callback_url": "https://shop.test/callback",
+	})
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestSchemaWithDefaults(t *testing.T) {
+	config := DriverConfig{"merchant_id": "m-1", "sandbox": "true"}
+	out := testSchema.WithDefaults(config)
+
+	if out["sandbox"] != "true" || out["timeout"] != "30s" {
+		t.Fatalf("WithDefaults = %v", out)
+	}
+	if _, ok := out["terminal_id"]; ok {
+		t.Fatal("key without a default was filled")
+	}
+	if _, ok := config["timeout"]; ok {
+		t.Fatal("WithDefaults modified its input")
+	}
+}
+
+func TestSchemaTemplateAndRedacted(t *testing.T) {
+	template := testSchema.Template()
+	if template["merchant_id"] != "<string>" || template["terminal_id"] != "<int>" || template["timeout"] != "30s" {
+		t.Fatalf("Template = %v", template)
+	}
+
+	redacted := testSchema.Redacted(DriverConfig{"merchant_id": "m-1", "terminal_id": "42"})
+	if redacted["merchant_id"] != "******" || redacted["terminal_id"] != "42" {
+		t.Fatalf("Redacted = %v", redacted)
+	}
+}
+
+func TestNewClientAppliesSchema(t *testing.T) {
+	_, err := NewClient(&Config{Drivers: map[string]DriverConfig{
+		"a": {DriverTypeKey: fakeDriverType, "terminal_id": "x"},
+		"b": {DriverTypeKey: fakeDriverType, "extra": "1"},
+	}})
+	if err == nil {
+		t.Fatal("NewClient accepted an invalid config")
+	}
+	for _, want := range []string{"driver 'a': key 'terminal_id'", "driver 'b': unknown key 'extra'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("NewClient err = %v, want %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+CREATE TABLE gopay_transactions (
+    id              VARCHAR(64)  PRIMARY KEY,
+    driver          VARCHAR(64)  NOT NULL,
+    authority       VARCHAR(255),
+    idempotency_key VARCHAR(255),
+    amount          BIGINT       NOT NULL,
+    amount_unit     VARCHAR(8)   NOT NULL,
+    state           VARCHAR(32)  NOT NULL,
+    reference_id    VARCHAR(255),
+    card_number     VARCHAR(32),
+    payloads        TEXT,
+    created_at      TIMESTAMP    NOT NULL,
+    updated_at      TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX gopay_transactions_authority_idx ON gopay_transactions (driver, authority);
+
+CREATE INDEX gopay_transactions_idempotency_idx ON gopay_transactions (driver, idempotency_key);
+
+CREATE TABLE gopay_state_changes (
+    transaction_id VARCHAR(64) NOT NULL REFERENCES gopay_transactions (id),
+    seq            INTEGER     NOT NULL,
+    from_state     VARCHAR(32) NOT NULL,
+    to_state       VARCHAR(32) NOT NULL,
+    changed_at     TIMESTAMP   NOT NULL,
+    reason         TEXT,
+    PRIMARY KEY (transaction_id, seq)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE gopay_transactions ADD COLUMN order_id VARCHAR(32);
+
+CREATE INDEX gopay_transactions_order_id_idx ON gopay_transactions (driver, order_id);
@@ -0,0 +1,449 @@
+// Package sqlstore پیاده‌سازی gopay.Store بر پایه database/sql با migration های
+// داخلی است و با SQLite و PostgreSQL کار می‌کند. درایور پایگاه‌داده (مثلاً
+// modernc.org/sqlite یا github.com/jackc/pgx/v5/stdlib) باید توسط برنامه import شود.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/arminmiraftab/GoPay"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+// rebind جای‌نگهدارهای ? را برای PostgreSQL به $1, $2, ... تبدیل می‌کند
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ gopay.Store = (*Store)(nil)
+var _ gopay.PendingSource = (*Store)(nil)
+
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{db: db, dialect: dialect}
+}
+
+// Fetcher یک TransactionFetcher برای درایور داده‌شده برمی‌گرداند
+func (s *Store) Fetcher(driver string) gopay.TransactionFetcher {
+	return gopay.StoreFetcher(s, driver)
+}
+
+// migrationLockKey کلید advisory lock پستگرس که اجرای هم‌زمان Migrate در چند نمونه را سریال می‌کند
+const migrationLockKey = 0x676f706179 // "gopay"
+
+// Migrate migration های اعمال‌نشده را به ترتیب نسخه و هر کدام در یک تراکنش اجرا می‌کند.
+// در PostgreSQL کل فرایند زیر pg_advisory_lock انجام می‌شود تا نمونه‌هایی که هم‌زمان
+// بالا می‌آیند روی schema رقابت نکنند. SQLite قفل بین‌فرایندی ندارد؛ آنجا Migrate
+// باید فقط از یک فرایند اجرا شود.
+func (s *Store) Migrate(ctx context.Context) error {
+	// advisory lock به session وابسته است، پس همه مراحل روی یک اتصال اجرا می‌شوند
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	if s.dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS gopay_schema_migrations (
+    version    INTEGER   PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL
+)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM gopay_schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "migrations/")
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("invalid migration file name '%s': %w", name, err)
+		}
+		if applied[version] {
+			continue
+		}
+		body, err := migrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := s.apply(ctx, conn, version, string(body)); err != nil {
+			return fmt.Errorf("migration '%s' failed: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) apply(ctx context.Context, conn *sql.Conn, version int, body string) error {
+	sqlTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	for _, stmt := range splitStatements(body) {
+		if _, err := sqlTx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := sqlTx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO gopay_schema_migrations (version, applied_at) VALUES (?, ?)`),
+		version, time.Now().UTC()); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// splitStatements متن migration را روی ; جدا می‌کند، اما ; داخل رشته‌ها، شناسه‌های
+// نقل‌قول‌دار، توضیحات و بلوک‌های $tag$ پستگرس را نادیده می‌گیرد
+func splitStatements(body string) []string {
+	var stmts []string
+	start := 0
+	flush := func(end int) {
+		if stmt := strings.TrimSpace(body[start:end]); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\'' || c == '"':
+			// نقل‌قول دوتایی ('' یا "") escape است و با همین حلقه پوشش داده می‌شود
+			if j := strings.IndexByte(body[i+1:], c); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(body)
+			}
+		case strings.HasPrefix(body[i:], "--"):
+			if j := strings.IndexByte(body[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(body)
+			}
+		case strings.HasPrefix(body[i:], "/*"):
+			if j := strings.Index(body[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(body)
+			}
+		case c == '$':
+			j := strings.IndexByte(body[i+1:], '$')
+			if j < 0 || !isDollarTag(body[i+1:i+1+j]) {
+				continue
+			}
+			tag := body[i : i+j+2]
+			if k := strings.Index(body[i+len(tag):], tag); k >= 0 {
+				i += len(tag) + k + len(tag) - 1
+			} else {
+				i = len(body)
+			}
+		case c == ';':
+			flush(i)
+			start = i + 1
+		}
+	}
+	if start < len(body) {
+		flush(len(body))
+	}
+	return stmts
+}
+
+// isDollarTag بررسی می‌کند که متن بین دو $ برچسب معتبر dollar-quote باشد (مثلاً $$ یا $body$)
+func isDollarTag(tag string) bool {
+	for i, r := range tag {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) Create(ctx context.Context, tx *gopay.Transaction) error {
+	if tx.ID == "" {
+		tx.ID = gopay.NewTransactionID()
+	}
+	payloads, err := marshalPayloads(tx.Payloads)
+	if err != nil {
+		return err
+	}
+
+	sqlTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	_, err = sqlTx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO gopay_transactions
+    (id, driver, authority, idempotency_key, order_id, amount, amount_unit, state, reference_id, card_number, payloads, created_at, updated_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		tx.ID, tx.Driver, nullString(tx.Authority), nullString(tx.IdempotencyKey), nullString(tx.OrderID), tx.Amount.Amount, tx.Amount.Unit.String(),
+		string(tx.State), nullString(tx.ReferenceID), nullString(gopay.MaskCardNumber(tx.CardNumber)), payloads,
+		tx.CreatedAt.UTC(), tx.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert transaction: %w", err)
+	}
+	if err := s.insertHistory(ctx, sqlTx, tx, 0); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func (s *Store) Update(ctx context.Context, tx *gopay.Transaction) error {
+	payloads, err := marshalPayloads(tx.Payloads)
+	if err != nil {
+		return err
+	}
+
+	sqlTx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	res, err := sqlTx.ExecContext(ctx, s.dialect.rebind(`UPDATE gopay_transactions
+    SET authority = ?, idempotency_key = ?, order_id = ?, amount = ?, amount_unit = ?, state = ?, reference_id = ?, card_number = ?, payloads = ?, updated_at = ?
+    WHERE id = ?`),
+		nullString(tx.Authority), nullString(tx.IdempotencyKey), nullString(tx.OrderID), tx.Amount.Amount, tx.Amount.Unit.String(), string(tx.State),
+		nullString(tx.ReferenceID), nullString(gopay.MaskCardNumber(tx.CardNumber)), payloads, tx.UpdatedAt.UTC(), tx.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return gopay.ErrTransactionNotFound
+	}
+
+	var stored int
+	if err := sqlTx.QueryRowContext(ctx, s.dialect.rebind(`SELECT COUNT(*) FROM gopay_state_changes WHERE transaction_id = ?`), tx.ID).Scan(&stored); err != nil {
+		return err
+	}
+	if err := s.insertHistory(ctx, sqlTx, tx, stored); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+// insertHistory تغییر وضعیت‌هایی از History که هنوز ذخیره نشده‌اند را اضافه می‌کند
+func (s *Store) insertHistory(ctx context.Context, sqlTx *sql.Tx, tx *gopay.Transaction, from int) error {
+	for i := from; i < len(tx.History); i++ {
+		change := tx.History[i]
+		_, err := sqlTx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO gopay_state_changes
+    (transaction_id, seq, from_state, to_state, changed_at, reason) VALUES (?, ?, ?, ?, ?, ?)`),
+			tx.ID, i, string(change.From), string(change.To), change.At.UTC(), change.Reason)
+		if err != nil {
+			return fmt.Errorf("failed to insert state change: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*gopay.Transaction, error) {
+	return s.findOne(ctx, `id = ?`, id)
+}
+
+func (s *Store) FindByAuthority(ctx context.Context, driver, authority string) (*gopay.Transaction, error) {
+	return s.findOne(ctx, `driver = ? AND authority = ?`, driver, authority)
+}
+
+func (s *Store) FindByIdempotencyKey(ctx context.Context, driver, key string) (*gopay.Transaction, error) {
+	return s.findOne(ctx, `driver = ? AND idempotency_key = ?`, driver, key)
+}
+
+func (s *Store) FindByOrderID(ctx context.Context, driver, orderID string) (*gopay.Transaction, error) {
+	return s.findOne(ctx, `driver = ? AND order_id = ?`, driver, orderID)
+}
+
+// PendingTransactions تراکنش‌های با وضعیت gopay.PendingStates قدیمی‌تر از before را
+// به ترتیب id و بعد از cursor برمی‌گرداند (gopay.PendingSource)
+func (s *Store) PendingTransactions(ctx context.Context, before time.Time, cursor string, limit int) ([]*gopay.Transaction, string, error) {
+	states := gopay.PendingStates()
+	args := make([]interface{}, 0, len(states)+3)
+	for _, state := range states {
+		args = append(args, string(state))
+	}
+	args = append(args, before.UTC(), cursor)
+	query := `SELECT ` + transactionColumns + ` FROM gopay_transactions
+    WHERE state IN (?` + strings.Repeat(", ?", len(states)-1) + `) AND created_at < ? AND id > ? ORDER BY id`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit+1)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list pending transactions: %w", err)
+	}
+	var txs []*gopay.Transaction
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			return nil, "", err
+		}
+		txs = append(txs, tx)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list pending transactions: %w", err)
+	}
+
+	next := ""
+	if limit > 0 && len(txs) > limit {
+		txs = txs[:limit]
+		next = txs[limit-1].ID
+	}
+	for _, tx := range txs {
+		if tx.History, err = s.history(ctx, tx.ID); err != nil {
+			return nil, "", err
+		}
+	}
+	return txs, next, nil
+}
+
+const transactionColumns = `id, driver, authority, idempotency_key, order_id, amount, amount_unit, state, reference_id, card_number, payloads, created_at, updated_at`
+
+func (s *Store) findOne(ctx context.Context, where string, args ...interface{}) (*gopay.Transaction, error) {
+	row := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT `+transactionColumns+`
+    FROM gopay_transactions WHERE `+where+` ORDER BY created_at DESC LIMIT 1`), args...)
+
+	tx, err := scanTransaction(row)
+	if err != nil {
+		return nil, err
+	}
+	if tx.History, err = s.history(ctx, tx.ID); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// scanner سطر مشترک *sql.Row و *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransaction(row scanner) (*gopay.Transaction, error) {
+	var (
+		tx                                            gopay.Transaction
+		authority, key, orderID, refID, card, payload sql.NullString
+		unit, state                                   string
+	)
+	err := row.Scan(&tx.ID, &tx.Driver, &authority, &key, &orderID, &tx.Amount.Amount, &unit, &state, &refID, &card, &payload, &tx.CreatedAt, &tx.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, gopay.ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction: %w", err)
+	}
+
+	tx.Authority, tx.IdempotencyKey, tx.OrderID = authority.String, key.String, orderID.String
+	tx.ReferenceID, tx.CardNumber = refID.String, card.String
+	tx.State = gopay.PaymentState(state)
+	if tx.Amount.Unit, err = gopay.ParseUnit(unit); err != nil {
+		return nil, err
+	}
+	if payload.String != "" {
+		if err := json.Unmarshal([]byte(payload.String), &tx.Payloads); err != nil {
+			return nil, fmt.Errorf("failed to decode payloads: %w", err)
+		}
+	}
+	return &tx, nil
+}
+
+func (s *Store) history(ctx context.Context, id string) ([]gopay.StateChange, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(`SELECT from_state, to_state, changed_at, reason
+    FROM gopay_state_changes WHERE transaction_id = ? ORDER BY seq`), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []gopay.StateChange
+	for rows.Next() {
+		var (
+			change   gopay.StateChange
+			from, to string
+			reason   sql.NullString
+		)
+		if err := rows.Scan(&from, &to, &change.At, &reason); err != nil {
+			return nil, err
+		}
+		change.From, change.To, change.Reason = gopay.PaymentState(from), gopay.PaymentState(to), reason.String
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+func marshalPayloads(payloads map[string]json.RawMessage) (sql.NullString, error) {
+	if len(payloads) == 0 {
+		return sql.NullString{}, nil
+	}
+	raw, err := json.Marshal(payloads)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode payloads: %w", err)
+	}
+	return sql.NullString{String: string(raw), Valid: true}, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,234 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/arminmiraftab/GoPay"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "gopay.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s := New(db, SQLite)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return s
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+
+	var versions int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM gopay_schema_migrations`).Scan(&versions); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := migrations.ReadDir("migrations")
+	if versions != len(files) {
+		t.Fatalf("applied %d migrations, want %d", versions, len(files))
+	}
+}
+
+func TestCreateUpdateKeepsHistory(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	now := time.Now()
+	tx := &gopay.Transaction{
+		Driver:         "zp",
+		IdempotencyKey: "key-1",
+		OrderID:        "1001",
+		Amount:         gopay.Tomans(5000),
+		State:          gopay.StateCreated,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.Create(ctx, tx); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if tx.ID == "" {
+		t.Fatal("Create did not assign an ID")
+	}
+
+	tx.Authority = "A100"
+	if err := tx.Transition(gopay.StateRedirected, ""); err != nil {
+		t.Fatal(err)
+	}
+	tx.SetPayload("purchase", map[string]string{"authority": "A100"})
+	if err := s.Update(ctx, tx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	tx.CardNumber = "6037991234567890"
+	if err := tx.Transition(gopay.StateCallbackReceived, "callback"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(ctx, tx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	got, err := s.Get(ctx, tx.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.State != gopay.StateCallbackReceived || got.Authority != "A100" {
+		t.Fatalf("got state=%s authority=%q", got.State, got.Authority)
+	}
+	if !got.Amount.Equal(gopay.Tomans(5000)) || got.Amount.Unit != gopay.Toman {
+		t.Fatalf("amount = %s, want 5000 toman", got.Amount)
+	}
+	if got.CardNumber != gopay.MaskCardNumber("6037991234567890") {
+		t.Fatalf("card number stored unmasked: %q", got.CardNumber)
+	}
+	if _, ok := got.Payloads["purchase"]; !ok {
+		t.Fatal("purchase payload was not stored")
+	}
+	if len(got.History) != 2 {
+		t.Fatalf("history has %d entries, want 2", len(got.History))
+	}
+	if h := got.History[1]; h.From != gopay.StateRedirected || h.To != gopay.StateCallbackReceived || h.Reason != "callback" {
+		t.Fatalf("unexpected history entry %+v", h)
+	}
+}
+
+func TestFindBy(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	now := time.Now()
+	tx := &gopay.Transaction{
+		Driver:         "mellat",
+		Authority:      "RefId-1",
+		IdempotencyKey: "key-1",
+		OrderID:        "42",
+		Amount:         gopay.Rials(10000),
+		State:          gopay.StateRedirected,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.Create(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := map[string]func() (*gopay.Transaction, error){
+		"authority":       func() (*gopay.Transaction, error) { return s.FindByAuthority(ctx, "mellat", "RefId-1") },
+		"order id":        func() (*gopay.Transaction, error) { return s.FindByOrderID(ctx, "mellat", "42") },
+		"idempotency key": func() (*gopay.Transaction, error) { return s.FindByIdempotencyKey(ctx, "mellat", "key-1") },
+	}
+	for name, find := range lookups {
+		got, err := find()
+		if err != nil {
+			t.Fatalf("find by %s: %v", name, err)
+		}
+		if got.ID != tx.ID {
+			t.Fatalf("find by %s returned %s, want %s", name, got.ID, tx.ID)
+		}
+	}
+
+	// کلیدها به تفکیک درایور هستند
+	if _, err := s.FindByIdempotencyKey(ctx, "zp", "key-1"); !errors.Is(err, gopay.ErrTransactionNotFound) {
+		t.Fatalf("lookup with another driver: err = %v, want ErrTransactionNotFound", err)
+	}
+	if _, err := s.FindByOrderID(ctx, "mellat", "43"); !errors.Is(err, gopay.ErrTransactionNotFound) {
+		t.Fatalf("unknown order id: err = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestUpdateUnknownTransaction(t *testing.T) {
+	s := newTestStore(t)
+	err := s.Update(context.Background(), &gopay.Transaction{ID: "missing", State: gopay.StateCreated})
+	if !errors.Is(err, gopay.ErrTransactionNotFound) {
+		t.Fatalf("err = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	if got := Postgres.rebind(`a = ? AND b = ?`); got != `a = $1 AND b = $2` {
+		t.Fatalf("Postgres rebind = %q", got)
+	}
+	if got := SQLite.rebind(`a = ?`); got != `a = ?` {
+		t.Fatalf("SQLite rebind = %q", got)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	body := `CREATE TABLE a (note TEXT DEFAULT 'x;y');
+-- comment; not a statement
+INSERT INTO "b;c" VALUES ('it''s; fine'); /* ; */
+CREATE FUNCTION f() RETURNS void AS $body$ BEGIN PERFORM 1; END $body$ LANGUAGE plpgsql;
+`
+	want := []string{
+		`CREATE TABLE a (note TEXT DEFAULT 'x;y')`,
+		"-- comment; not a statement\nINSERT INTO \"b;c\" VALUES ('it''s; fine')",
+		`/* ; */
+CREATE FUNCTION f() RETURNS void AS $body$ BEGIN PERFORM 1; END $body$ LANGUAGE plpgsql`,
+	}
+	if got := splitStatements(body); !slices.Equal(got, want) {
+		t.Fatalf("splitStatements =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestPendingTransactionsComparesInUTC(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	created := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	tx := &gopay.Transaction{Driver: "zp", Amount: gopay.Tomans(1000), State: gopay.StateRedirected, CreatedAt: created, UpdatedAt: created}
+	if err := s.Create(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 12:00 در تهران (+03:30) برابر 08:30 UTC و پیش از ساخت تراکنش است
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	before := time.Date(2026, 3, 1, 12, 0, 0, 0, tehran)
+	txs, _, err := s.PendingTransactions(ctx, before, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 0 {
+		t.Fatalf("transaction created at %v listed as older than %v", created, before)
+	}
+
+	txs, _, err = s.PendingTransactions(ctx, before.Add(2*time.Hour), "", 10)
+	if err != nil || len(txs) != 1 {
+		t.Fatalf("got %d transactions, err %v; want 1", len(txs), err)
+	}
+}
+
+func TestPendingTransactionsListsPendingStates(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	now := time.Now()
+	for _, state := range []gopay.PaymentState{gopay.StateReversePending, gopay.StateSettled, gopay.StateManualReview, gopay.StateVerified} {
+		tx := &gopay.Transaction{Driver: "fanava", Amount: gopay.Rials(1000), State: state, CreatedAt: now, UpdatedAt: now}
+		if err := s.Create(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txs, _, err := s.PendingTransactions(ctx, now.Add(time.Minute), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states []gopay.PaymentState
+	for _, tx := range txs {
+		states = append(states, tx.State)
+	}
+	if len(states) != 2 || !slices.Contains(states, gopay.StateReversePending) || !slices.Contains(states, gopay.StateVerified) {
+		t.Fatalf("pending states = %v, want reverse_pending and verified", states)
+	}
+}
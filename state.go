@@ -0,0 +1,99 @@
+package gopay
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrInvalidTransition زمانی برگردانده می‌شود که تغییر وضعیت درخواستی در چرخه پرداخت مجاز نباشد
+var ErrInvalidTransition = errors.New("invalid payment state transition")
+
+type PaymentState string
+
+const (
+	StateCreated          PaymentState = "created"
+	StateRedirected       PaymentState = "redirected"
+	StateCallbackReceived PaymentState = "callback_received"
+	StateVerified         PaymentState = "verified"
+	StateSettled          PaymentState = "settled"
+	StateFailed           PaymentState = "failed"
+	StateCancelled        PaymentState = "cancelled"
+	StateReversed         PaymentState = "reversed"
+	StateRefunded         PaymentState = "refunded"
+	StateManualReview     PaymentState = "manual_review"
+	StateReversePending   PaymentState = "reverse_pending"
+)
+
+// transitions تغییر وضعیت‌های مجاز چرخه پرداخت:
+//
+//	created → redirected → callback_received → verified → settled → refunded
+//
+// با شاخه‌های failed، cancelled و reversed از مراحل میانی. reverse_pending تراکنشی است
+// که وجه آن برداشت شده و باید برگشت بخورد ولی برگشت آن شکست خورده است؛ Reconciler
+// برگشت را تا موفقیت تکرار می‌کند. manual_review تراکنشی است
+// که Reconciler نمی‌تواند خودکار نهایی کند (مثلاً برگشت وجه در درگاهی که Reverser
+// نیست) و پس از رسیدگی اپراتور به settled، reversed یا refunded می‌رود.
+var transitions = map[PaymentState][]PaymentState{
+	StateCreated:          {StateRedirected, StateFailed, StateCancelled},
+	StateRedirected:       {StateCallbackReceived, StateFailed, StateCancelled},
+	StateCallbackReceived: {StateVerified, StateFailed, StateCancelled, StateReversed, StateReversePending, StateManualReview},
+	StateVerified:         {StateSettled, StateFailed, StateReversed, StateRefunded, StateReversePending, StateManualReview},
+	StateSettled:          {StateRefunded},
+	StateReversePending:   {StateReversed, StateManualReview},
+	StateManualReview:     {StateSettled, StateReversed, StateRefunded},
+}
+
+// pendingStates وضعیت‌هایی که Reconciler بررسی می‌کند
+var pendingStates = []PaymentState{StateRedirected, StateCallbackReceived, StateVerified, StateReversePending}
+
+// CanTransition بررسی می‌کند که تغییر وضعیت از from به to مجاز است یا نه
+func CanTransition(from, to PaymentState) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal وضعیت‌هایی که تغییر بعدی ندارند
+func (s PaymentState) IsTerminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// IsPending وضعیت‌هایی که نتیجه نهایی پرداخت هنوز از درگاه گرفته نشده، تسویه کامل
+// نشده یا برگشت آن ناتمام مانده است (redirected، callback_received، verified و
+// reverse_pending)؛ Reconciler این تراکنش‌ها را بررسی می‌کند
+func (s PaymentState) IsPending() bool {
+	return slices.Contains(pendingStates, s)
+}
+
+// PendingStates وضعیت‌هایی که IsPending برای آن‌ها true است؛ برای پیاده‌سازی PendingSource
+func PendingStates() []PaymentState {
+	return slices.Clone(pendingStates)
+}
+
+type StateChange struct {
+	From   PaymentState
+	To     PaymentState
+	At     time.Time
+	Reason string
+}
+
+// Transition وضعیت تراکنش را پس از بررسی مجاز بودن تغییر می‌دهد و آن را در History ثبت می‌کند
+func (t *Transaction) Transition(to PaymentState, reason string) error {
+	return t.TransitionAt(to, reason, time.Now())
+}
+
+// TransitionAt مانند Transition است ولی زمان تغییر را از at می‌گیرد (مثلاً از Clock ِ Reconciler)
+func (t *Transaction) TransitionAt(to PaymentState, reason string, at time.Time) error {
+	if !CanTransition(t.State, to) {
+		return fmt.Errorf("%s -> %s: %w", t.State, to, ErrInvalidTransition)
+	}
+	t.History = append(t.History, StateChange{From: t.State, To: to, At: at, Reason: reason})
+	t.State = to
+	t.UpdatedAt = at
+	return nil
+}
@@ -0,0 +1,164 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	allowed := [][2]PaymentState{
+		{StateCreated, StateRedirected},
+		{StateRedirected, StateCallbackReceived},
+		{StateCallbackReceived, StateVerified},
+		{StateVerified, StateSettled},
+		{StateSettled, StateRefunded},
+		{StateCallbackReceived, StateReversed},
+		{StateRedirected, StateCancelled},
+		{StateCallbackReceived, StateManualReview},
+		{StateManualReview, StateRefunded},
+		{StateCallbackReceived, StateReversePending},
+		{StateReversePending, StateReversed},
+	}
+	for _, tt := range allowed {
+		if !CanTransition(tt[0], tt[1]) {
+			t.Errorf("%s -> %s rejected", tt[0], tt[1])
+		}
+	}
+
+	rejected := [][2]PaymentState{
+		{StateCreated, StateSettled},
+		{StateSettled, StateFailed},
+		{StateFailed, StateVerified},
+		{StateRefunded, StateSettled},
+		{StateCancelled, StateRedirected},
+		{StateManualReview, StateCallbackReceived},
+		{StateReversePending, StateFailed},
+	}
+	for _, tt := range rejected {
+		if CanTransition(tt[0], tt[1]) {
+			t.Errorf("%s -> %s allowed", tt[0], tt[1])
+		}
+	}
+}
+
+func TestTerminalAndPendingStates(t *testing.T) {
+	for _, s := range []PaymentState{StateFailed, StateCancelled, StateReversed, StateRefunded} {
+		if !s.IsTerminal() || s.IsPending() {
+			t.Errorf("%s: terminal %v, pending %v", s, s.IsTerminal(), s.IsPending())
+		}
+	}
+	for _, s := range []PaymentState{StateRedirected, StateCallbackReceived, StateVerified, StateReversePending} {
+		if s.IsTerminal() || !s.IsPending() {
+			t.Errorf("%s: terminal %v, pending %v", s, s.IsTerminal(), s.IsPending())
+		}
+	}
+}
+
+func TestTransitionRecordsHistory(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tx := &Transaction{State: StateCreated}
+
+	if err := tx.TransitionAt(StateRedirected, "purchase", at); err != nil {
+		t.Fatalf("TransitionAt: %v", err)
+	}
+	err := tx.TransitionAt(StateSettled, "skip", at.Add(time.Minute))
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("err = %v, want ErrInvalidTransition", err)
+	}
+
+	want := []StateChange{{From: StateCreated, To: StateRedirected, At: at, Reason: "purchase"}}
+	if tx.State != StateRedirected || !tx.UpdatedAt.Equal(at) || !slices.Equal(tx.History, want) {
+		t.Fatalf("tx = %+v", tx)
+	}
+}
+
+func TestClientLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, []string{"zp"})
+	tx := purchaseTx(t, c, "zp")
+	if tx.State != StateRedirected {
+		t.Fatalf("state after purchase = %s", tx.State)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/callback?key="+tx.Authority, nil)
+	if _, err := c.VerifyAndConfirm(ctx, "zp", r); err != nil {
+		t.Fatalf("VerifyAndConfirm: %v", err)
+	}
+	tx, err := c.Store().Get(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []PaymentState
+	for _, change := range tx.History {
+		got = append(got, change.To)
+	}
+	want := []PaymentState{StateRedirected, StateCallbackReceived, StateVerified, StateSettled}
+	if !slices.Equal(got, want) || tx.ReferenceID != "R-"+tx.Authority {
+		t.Fatalf("history %v, reference %q; want %v", got, tx.ReferenceID, want)
+	}
+}
+
+func TestClientRecordsFailedPurchase(t *testing.T) {
+	c := newTestClient(t, []string{"zp"})
+	fakeOf(t, c, "zp").purchase = func(context.Context, *TransactionRequest) (*PaymentResponse, error) {
+		return nil, &GatewayError{Driver: fakeDriverType, Kind: ErrInvalidAmount, Message: "rejected"}
+	}
+	if _, err := c.Purchase(context.Background(), "zp", &TransactionRequest{Amount: Rials(10000), IdempotencyKey: "k1"}); err == nil {
+		t.Fatal("Purchase succeeded")
+	}
+	tx, err := c.Store().FindByIdempotencyKey(context.Background(), "zp", "k1")
+	if err != nil || tx.State != StateFailed {
+		t.Fatalf("tx = %+v, %v; want a failed transaction", tx, err)
+	}
+}
+
+func TestClientKeepsUnknownVerificationPending(t *testing.T) {
+	tests := map[string]func(context.Context, *http.Request, TransactionFetcher) (*VerificationResponse, error){
+		"retryable error": func(ctx context.Context, r *http.Request, fetcher TransactionFetcher) (*VerificationResponse, error) {
+			if _, err := fetcher(ctx, "A1"); err != nil {
+				return nil, err
+			}
+			return &VerificationResponse{Status: StatusFailed, FailedStage: OpVerify}, &GatewayError{Kind: ErrGatewayUnavailable}
+		},
+		"no response": func(ctx context.Context, r *http.Request, fetcher TransactionFetcher) (*VerificationResponse, error) {
+			if _, err := fetcher(ctx, "A1"); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("connection reset")
+		},
+	}
+	for name, verify := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c := newTestClient(t, []string{"zp"})
+			driver := fakeOf(t, c, "zp")
+			tx := purchaseTx(t, c, "zp")
+			callback := httptest.NewRequest(http.MethodGet, "/callback?key="+tx.Authority, nil)
+
+			driver.verify = verify
+			if _, err := c.VerifyAndConfirm(ctx, "zp", callback); err == nil {
+				t.Fatal("VerifyAndConfirm hid the driver error")
+			}
+			tx, _ = c.Store().Get(ctx, tx.ID)
+			if tx.State != StateCallbackReceived || !tx.State.IsPending() {
+				t.Fatalf("state = %s, want a pending callback_received", tx.State)
+			}
+
+			// callback تکراری پس از رفع خطا پرداخت را نهایی می‌کند
+			driver.verify = nil
+			resp, err := c.VerifyAndConfirm(ctx, "zp", callback)
+			if err != nil || resp.Status != StatusSuccess {
+				t.Fatalf("retried callback = %+v, %v", resp, err)
+			}
+			if tx, _ = c.Store().Get(ctx, tx.ID); tx.State != StateSettled {
+				t.Fatalf("state after retry = %s", tx.State)
+			}
+		})
+	}
+}
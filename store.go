@@ -0,0 +1,277 @@
+package gopay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTransactionNotFound زمانی برگردانده می‌شود که تراکنش در Store یافت نشود
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// Transaction رکورد ذخیره‌شده یک پرداخت در طول چرخه عمر آن
+type Transaction struct {
+	ID             string
+	Driver         string
+	Authority      string
+	IdempotencyKey string
+	OrderID        string
+	Amount         Money
+	State          PaymentState
+	ReferenceID    string
+	CardNumber     string // همیشه به صورت پوشانده‌شده ذخیره می‌شود
+	History        []StateChange
+	Payloads       map[string]json.RawMessage // پاسخ‌های خام درگاه به تفکیک مرحله (purchase, verify, ...)
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (t *Transaction) clone() *Transaction {
+	c := *t
+	c.History = append([]StateChange(nil), t.History...)
+	if t.Payloads != nil {
+		c.Payloads = make(map[string]json.RawMessage, len(t.Payloads))
+		for k, v := range t.Payloads {
+			c.Payloads[k] = v
+		}
+	}
+	return &c
+}
+
+// Store لایه ذخیره‌سازی تراکنش‌ها؛ Client هر تغییر وضعیت را از طریق آن ذخیره می‌کند
+type Store interface {
+	Create(ctx context.Context, tx *Transaction) error
+	Update(ctx context.Context, tx *Transaction) error
+	Get(ctx context.Context, id string) (*Transaction, error)
+	FindByAuthority(ctx context.Context, driver, authority string) (*Transaction, error)
+	FindByIdempotencyKey(ctx context.Context, driver, key string) (*Transaction, error)
+	FindByOrderID(ctx context.Context, driver, orderID string) (*Transaction, error)
+}
+
+// StoreFetcher یک TransactionFetcher بر پایه Store می‌سازد. کلیدی که درایور می‌دهد
+// به ترتیب به عنوان Authority، OrderID و IdempotencyKey جستجو می‌شود، چون برخی
+// درایورها (مثل behpardakht_v1) تراکنش را با شماره سفارش پیدا می‌کنند.
+func StoreFetcher(store Store, driver string) TransactionFetcher {
+	return func(ctx context.Context, key string) (*OriginalTransaction, error) {
+		tx, err := findTransaction(ctx, store, driver, key)
+		if err != nil {
+			return nil, err
+		}
+		return &OriginalTransaction{Amount: tx.Amount}, nil
+	}
+}
+
+func findTransaction(ctx context.Context, store Store, driver, key string) (*Transaction, error) {
+	tx, err := store.FindByAuthority(ctx, driver, key)
+	if errors.Is(err, ErrTransactionNotFound) {
+		tx, err = store.FindByOrderID(ctx, driver, key)
+	}
+	if errors.Is(err, ErrTransactionNotFound) {
+		tx, err = store.FindByIdempotencyKey(ctx, driver, key)
+	}
+	return tx, err
+}
+
+// SetPayload پاسخ خام یک مرحله را به صورت JSON در تراکنش ثبت می‌کند
+func (t *Transaction) SetPayload(stage string, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if t.Payloads == nil {
+		t.Payloads = make(map[string]json.RawMessage)
+	}
+	t.Payloads[stage] = raw
+}
+
+// Ref شناسه‌های تراکنش را برای عملیات‌های پس از پرداخت (استعلام، برگشت، بازپرداخت) برمی‌گرداند
+func (t *Transaction) Ref() *TransactionRef {
+	return &TransactionRef{
+		Authority:   t.Authority,
+		OrderID:     t.OrderID,
+		ReferenceID: t.ReferenceID,
+		Amount:      t.Amount,
+	}
+}
+
+// Refunds بازپرداخت‌های ثبت‌شده تراکنش (payload "refunds") را به ترتیب ثبت برمی‌گرداند
+func (t *Transaction) Refunds() ([]*RefundResponse, error) {
+	raw, ok := t.Payloads["refunds"]
+	if !ok {
+		return nil, nil
+	}
+	var refunds []*RefundResponse
+	if err := json.Unmarshal(raw, &refunds); err != nil {
+		return nil, fmt.Errorf("invalid refunds payload: %w", err)
+	}
+	return refunds, nil
+}
+
+// refundAttemptPayload کلید payload بازپرداخت ارسال‌شده‌ای که نتیجه‌اش هنوز ثبت نشده است
+const refundAttemptPayload = "refund_attempt"
+
+// RefundAttempt بازپرداختی که پیش از تماس با درگاه ثبت می‌شود؛ اگر پاسخ درگاه گم شود
+// تا ثبت نتیجه با Client.ResolveRefund باقی می‌ماند
+type RefundAttempt struct {
+	Amount      Money
+	Reason      RefundReason
+	RequestedAt time.Time
+}
+
+// PendingRefund بازپرداخت در جریان تراکنش (payload "refund_attempt") را برمی‌گرداند؛
+// nil یعنی بازپرداخت نامعلومی وجود ندارد
+func (t *Transaction) PendingRefund() (*RefundAttempt, error) {
+	raw, ok := t.Payloads[refundAttemptPayload]
+	if !ok {
+		return nil, nil
+	}
+	var attempt RefundAttempt
+	if err := json.Unmarshal(raw, &attempt); err != nil {
+		return nil, fmt.Errorf("invalid refund attempt payload: %w", err)
+	}
+	return &attempt, nil
+}
+
+// RefundedAmount مجموع بازپرداخت‌های تکمیل‌شده یا در انتظار واریز تراکنش است
+func (t *Transaction) RefundedAmount() (Money, error) {
+	refunds, err := t.Refunds()
+	if err != nil {
+		return Money{}, err
+	}
+	var total int64
+	for _, refund := range refunds {
+		if refund.Status != RefundFailed {
+			total += refund.Amount.Rials()
+		}
+	}
+	return Rials(total), nil
+}
+
+// NewTransactionID یک شناسه تصادفی ۱۲۸ بیتی برای تراکنش تولید می‌کند
+func NewTransactionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MemoryStore پیاده‌سازی درون‌حافظه‌ای Store برای تست و سرویس‌های تک‌نمونه‌ای
+type MemoryStore struct {
+	mu  sync.RWMutex
+	txs map[string]*Transaction
+}
+
+var _ Store = (*MemoryStore)(nil)
+var _ PendingSource = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{txs: make(map[string]*Transaction)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, tx *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx.ID == "" {
+		tx.ID = NewTransactionID()
+	}
+	if _, exists := s.txs[tx.ID]; exists {
+		return errors.New("transaction '" + tx.ID + "' already exists")
+	}
+	s.txs[tx.ID] = tx.clone()
+	return nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, tx *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.txs[tx.ID]; !exists {
+		return ErrTransactionNotFound
+	}
+	s.txs[tx.ID] = tx.clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, ok := s.txs[id]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	return tx.clone(), nil
+}
+
+func (s *MemoryStore) FindByAuthority(ctx context.Context, driver, authority string) (*Transaction, error) {
+	return s.find(func(tx *Transaction) bool {
+		return tx.Driver == driver && tx.Authority != "" && tx.Authority == authority
+	})
+}
+
+func (s *MemoryStore) FindByIdempotencyKey(ctx context.Context, driver, key string) (*Transaction, error) {
+	return s.find(func(tx *Transaction) bool {
+		return tx.Driver == driver && tx.IdempotencyKey != "" && tx.IdempotencyKey == key
+	})
+}
+
+func (s *MemoryStore) FindByOrderID(ctx context.Context, driver, orderID string) (*Transaction, error) {
+	return s.find(func(tx *Transaction) bool {
+		return tx.Driver == driver && tx.OrderID != "" && tx.OrderID == orderID
+	})
+}
+
+// find جدیدترین تراکنش منطبق را برمی‌گرداند (مانند ORDER BY created_at DESC در sqlstore)،
+// مثلاً تلاش جدید Purchase پس از یک تلاش ناموفق با همان IdempotencyKey
+func (s *MemoryStore) find(match func(*Transaction) bool) (*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *Transaction
+	for _, tx := range s.txs {
+		if !match(tx) {
+			continue
+		}
+		if found == nil || tx.CreatedAt.After(found.CreatedAt) ||
+			(tx.CreatedAt.Equal(found.CreatedAt) && tx.ID > found.ID) {
+			found = tx
+		}
+	}
+	if found == nil {
+		return nil, ErrTransactionNotFound
+	}
+	return found.clone(), nil
+}
+
+func (s *MemoryStore) PendingTransactions(ctx context.Context, before time.Time, cursor string, limit int) ([]*Transaction, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pending []*Transaction
+	for _, tx := range s.txs {
+		if tx.State.IsPending() && tx.CreatedAt.Before(before) && tx.ID > cursor {
+			pending = append(pending, tx)
+		}
+	}
+	slices.SortFunc(pending, func(a, b *Transaction) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	next := ""
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+		next = pending[limit-1].ID
+	}
+	txs := make([]*Transaction, len(pending))
+	for i, tx := range pending {
+		txs[i] = tx.clone()
+	}
+	return txs, next, nil
+}
@@ -0,0 +1,132 @@
+package gopay
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	tx := &Transaction{Driver: "zp", Authority: "A1", State: StateCreated}
+	if err := s.Create(ctx, tx); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if tx.ID == "" {
+		t.Fatal("Create did not assign an ID")
+	}
+	if err := s.Create(ctx, tx); err == nil {
+		t.Fatal("Create accepted a duplicate ID")
+	}
+
+	// تغییر نمونه فراخواننده بدون Update نباید در Store دیده شود
+	_ = tx.Transition(StateRedirected, "")
+	stored, err := s.Get(ctx, tx.ID)
+	if err != nil || stored.State != StateCreated || len(stored.History) != 0 {
+		t.Fatalf("stored = %+v, %v", stored, err)
+	}
+
+	if err := s.Update(ctx, tx); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	stored, _ = s.Get(ctx, tx.ID)
+	if stored.State != StateRedirected || len(stored.History) != 1 {
+		t.Fatalf("stored after update = %+v", stored)
+	}
+
+	if err := s.Update(ctx, &Transaction{ID: "missing"}); !errors.Is(err, ErrTransactionNotFound) {
+		t.Fatalf("Update(missing) = %v", err)
+	}
+}
+
+func TestMemoryStoreFind(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	for _, tx := range []*Transaction{
+		{Driver: "zp", Authority: "A1", IdempotencyKey: "k1"},
+		{Driver: "mellat", OrderID: "1001"},
+	} {
+		if err := s.Create(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tx, err := s.FindByAuthority(ctx, "zp", "A1"); err != nil || tx.IdempotencyKey != "k1" {
+		t.Errorf("FindByAuthority = %+v, %v", tx, err)
+	}
+	if _, err := s.FindByAuthority(ctx, "mellat", "A1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("FindByAuthority matched another driver: %v", err)
+	}
+	// کلیدهای خالی هرگز با تراکنش‌هایی که آن کلید را ندارند تطبیق داده نمی‌شوند
+	if _, err := s.FindByOrderID(ctx, "zp", ""); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("FindByOrderID matched an empty key: %v", err)
+	}
+
+	fetch := StoreFetcher(s, "mellat")
+	if original, err := fetch(ctx, "1001"); err != nil || original == nil {
+		t.Errorf("StoreFetcher by order id = %+v, %v", original, err)
+	}
+	if _, err := StoreFetcher(s, "zp")(ctx, "k1"); err != nil {
+		t.Errorf("StoreFetcher by idempotency key: %v", err)
+	}
+}
+
+func TestMemoryStoreFindReturnsNewestMatch(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+	// تلاش ناموفق قبلی و تلاش جدید با همان IdempotencyKey
+	for i, state := range []PaymentState{StateFailed, StateRedirected, StateFailed} {
+		tx := &Transaction{Driver: "zp", IdempotencyKey: "k1", State: state, CreatedAt: now.Add(time.Duration(i-1) * time.Minute)}
+		if i == 2 {
+			tx.CreatedAt = now.Add(-time.Hour)
+		}
+		if err := s.Create(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 20 {
+		tx, err := s.FindByIdempotencyKey(ctx, "zp", "k1")
+		if err != nil || tx.State != StateRedirected {
+			t.Fatalf("FindByIdempotencyKey = %+v, %v; want the newest attempt", tx, err)
+		}
+	}
+}
+
+func TestMemoryStorePendingTransactions(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+	for i, state := range []PaymentState{StateRedirected, StateVerified, StateSettled, StateCallbackReceived, StateRedirected} {
+		created := now.Add(-time.Hour)
+		if i == 4 {
+			created = now
+		}
+		if err := s.Create(ctx, &Transaction{ID: string(rune('a' + i)), State: state, CreatedAt: created}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []string
+	cursor := ""
+	for {
+		page, next, err := s.PendingTransactions(ctx, now.Add(-time.Minute), cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range page {
+			ids = append(ids, tx.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !slices.Equal(ids, []string{"a", "b", "d"}) {
+		t.Fatalf("pending = %v, want [a b d]", ids)
+	}
+}